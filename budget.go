@@ -0,0 +1,140 @@
+package ragclient
+
+import (
+	"fmt"
+)
+
+// DocumentPlacement tells how a document is expected to reach the model
+type DocumentPlacement string
+
+const (
+	// PlacementFullText means the whole document fits in the full-text budget
+	PlacementFullText DocumentPlacement = "full_text"
+	// PlacementSegment means only segments extracted from the document are used
+	PlacementSegment DocumentPlacement = "segment"
+)
+
+// BudgetPlan explains how the context window is divided between full-text
+// documents, extracted segments and the rest of the prompt
+type BudgetPlan struct {
+	// Total context window (RagContextWindowLimit)
+	WindowLimit int
+	// Tokens reserved for documents included as full text
+	FullTextTokens int
+	// Tokens reserved for segments extracted from the remaining documents
+	SegmentTokens int
+	// Tokens left for the question, conversation and answer.
+	// Negative when the ratios sum to more than 1.
+	LeftoverTokens int
+
+	// FullTextRatio + SegmentRatio
+	RatioSum float64
+	// True when RatioSum exceeds 1, i.e. the budgets overlap
+	RatiosExceedOne bool
+	// Human readable warnings about the configuration
+	Warnings []string
+
+	// Per document prediction, in the order of the corpus stats
+	Documents []DocumentPlan
+	// Tokens used by the documents placed as full text
+	FullTextUsed int
+}
+
+// DocumentPlan is the predicted placement of a single document
+type DocumentPlan struct {
+	File      string
+	Tokens    int
+	Placement DocumentPlacement
+	// Why the document was placed this way
+	Reason string
+}
+
+// FullTextDocuments returns the documents predicted to fit as full text
+func (p *BudgetPlan) FullTextDocuments() []DocumentPlan {
+	var docs []DocumentPlan
+	for _, doc := range p.Documents {
+		if doc.Placement == PlacementFullText {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// PlanBudget computes how RagContextWindowLimit is split by FullTextRatio
+// and SegmentRatio, and predicts which documents fit as full text
+//
+// corpusStats is typically the result of CountTokensDir and may be nil when
+// only the budget is needed. Documents are considered in the order given,
+// which should be the expected relevance order: auto-coder.rag adds documents
+// as full text until one does not fit, and only uses extracted segments of
+// that document and all following ones.
+//
+// Example:
+//
+//	stats, err := client.CountTokensDir("", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	plan, err := ragclient.PlanBudget(config, stats)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, doc := range plan.Documents {
+//	    fmt.Printf("%s: %s (%s)\n", doc.File, doc.Placement, doc.Reason)
+//	}
+func PlanBudget(config *RAGConfig, corpusStats *TokenCountResult) (*BudgetPlan, error) {
+	if config == nil {
+		return nil, &ValidationError{Message: "config is required"}
+	}
+	if err := validateRAGParams(config.RagContextWindowLimit, config.FullTextRatio, config.SegmentRatio, config.RagDocFilterRelevance); err != nil {
+		return nil, err
+	}
+
+	limit := config.RagContextWindowLimit
+	plan := &BudgetPlan{
+		WindowLimit:    limit,
+		FullTextTokens: int(float64(limit) * config.FullTextRatio),
+		SegmentTokens:  int(float64(limit) * config.SegmentRatio),
+		RatioSum:       config.FullTextRatio + config.SegmentRatio,
+	}
+	plan.LeftoverTokens = limit - plan.FullTextTokens - plan.SegmentTokens
+
+	if plan.RatioSum > 1 {
+		plan.RatiosExceedOne = true
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+			"FullTextRatio + SegmentRatio = %v 超过 1, 文档预算超出上下文窗口 %d tokens",
+			plan.RatioSum, -plan.LeftoverTokens))
+	}
+	if plan.FullTextTokens == 0 {
+		plan.Warnings = append(plan.Warnings, "全文预算为 0, 所有文档都只会以片段形式使用")
+	}
+
+	if corpusStats == nil {
+		return plan, nil
+	}
+
+	full := true
+	for _, file := range corpusStats.Files {
+		doc := DocumentPlan{File: file.File, Tokens: file.Tokens}
+		switch {
+		case full && plan.FullTextUsed+file.Tokens <= plan.FullTextTokens:
+			plan.FullTextUsed += file.Tokens
+			doc.Placement = PlacementFullText
+			doc.Reason = fmt.Sprintf("全文放入, 累计 %d/%d tokens", plan.FullTextUsed, plan.FullTextTokens)
+		case file.Tokens > plan.FullTextTokens:
+			full = false
+			doc.Placement = PlacementSegment
+			doc.Reason = fmt.Sprintf("文档 %d tokens 超过全文预算 %d tokens, 仅使用抽取的片段", file.Tokens, plan.FullTextTokens)
+		case full:
+			full = false
+			doc.Placement = PlacementSegment
+			doc.Reason = fmt.Sprintf("全文预算剩余 %d tokens, 不足以放入 %d tokens 的文档, 仅使用抽取的片段",
+				plan.FullTextTokens-plan.FullTextUsed, file.Tokens)
+		default:
+			doc.Placement = PlacementSegment
+			doc.Reason = "排在无法全文放入的文档之后, 仅使用抽取的片段"
+		}
+		plan.Documents = append(plan.Documents, doc)
+	}
+	return plan, nil
+}
@@ -0,0 +1,132 @@
+package ragclient
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanBudget(t *testing.T) {
+	stats := func(tokens ...int) *TokenCountResult {
+		result := &TokenCountResult{}
+		for i, n := range tokens {
+			result.Files = append(result.Files, TokenCountFileResult{File: string(rune('a'+i)) + ".md", Tokens: n})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		limit      int
+		fullText   float64
+		segment    float64
+		stats      *TokenCountResult
+		fullTokens int
+		segTokens  int
+		leftover   int
+		placements []DocumentPlacement
+		fullUsed   int
+		exceedsOne bool
+		warnings   []string // substrings of the expected warnings, in order
+	}{
+		{
+			name: "budget only", limit: 1000, fullText: 0.7, segment: 0.2,
+			fullTokens: 700, segTokens: 200, leftover: 100,
+		},
+		{
+			name: "all documents fit", limit: 1000, fullText: 0.7, segment: 0.2, stats: stats(300, 400),
+			fullTokens: 700, segTokens: 200, leftover: 100,
+			placements: []DocumentPlacement{PlacementFullText, PlacementFullText}, fullUsed: 700,
+		},
+		{
+			name: "overflow moves the rest to segments", limit: 1000, fullText: 0.7, segment: 0.2, stats: stats(300, 500, 100),
+			fullTokens: 700, segTokens: 200, leftover: 100,
+			// c.md 虽然放得下, 但排在无法全文放入的文档之后
+			placements: []DocumentPlacement{PlacementFullText, PlacementSegment, PlacementSegment}, fullUsed: 300,
+		},
+		{
+			name: "document larger than the budget", limit: 1000, fullText: 0.5, segment: 0.3, stats: stats(600, 100),
+			fullTokens: 500, segTokens: 300, leftover: 200,
+			placements: []DocumentPlacement{PlacementSegment, PlacementSegment},
+		},
+		{
+			name: "ratios sum to more than 1", limit: 1000, fullText: 0.8, segment: 0.4, stats: stats(800),
+			fullTokens: 800, segTokens: 400, leftover: -200,
+			placements: []DocumentPlacement{PlacementFullText}, fullUsed: 800,
+			exceedsOne: true, warnings: []string{"超过 1, 文档预算超出上下文窗口 200 tokens"},
+		},
+		{
+			name: "no full text budget", limit: 1000, fullText: 0, segment: 0.5, stats: stats(1),
+			segTokens: 500, leftover: 500,
+			placements: []DocumentPlacement{PlacementSegment},
+			warnings:   []string{"全文预算为 0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewRAGConfig("./docs")
+			config.RagContextWindowLimit = tt.limit
+			config.FullTextRatio = tt.fullText
+			config.SegmentRatio = tt.segment
+
+			plan, err := PlanBudget(config, tt.stats)
+			if err != nil {
+				t.Fatalf("PlanBudget() error = %v", err)
+			}
+			if plan.WindowLimit != tt.limit || plan.FullTextTokens != tt.fullTokens ||
+				plan.SegmentTokens != tt.segTokens || plan.LeftoverTokens != tt.leftover {
+				t.Errorf("budget = %d/%d/%d/%d, want %d/%d/%d/%d",
+					plan.WindowLimit, plan.FullTextTokens, plan.SegmentTokens, plan.LeftoverTokens,
+					tt.limit, tt.fullTokens, tt.segTokens, tt.leftover)
+			}
+			if plan.RatiosExceedOne != tt.exceedsOne {
+				t.Errorf("RatiosExceedOne = %v, want %v", plan.RatiosExceedOne, tt.exceedsOne)
+			}
+
+			if len(plan.Warnings) != len(tt.warnings) {
+				t.Fatalf("Warnings = %q, want %d", plan.Warnings, len(tt.warnings))
+			}
+			for i, warning := range tt.warnings {
+				if !strings.Contains(plan.Warnings[i], warning) {
+					t.Errorf("Warnings[%d] = %q, want it to contain %q", i, plan.Warnings[i], warning)
+				}
+			}
+
+			var placements []DocumentPlacement
+			for _, doc := range plan.Documents {
+				placements = append(placements, doc.Placement)
+				if doc.Reason == "" {
+					t.Errorf("%s has no reason", doc.File)
+				}
+			}
+			if !reflect.DeepEqual(placements, tt.placements) {
+				t.Errorf("placements = %v, want %v", placements, tt.placements)
+			}
+			if plan.FullTextUsed != tt.fullUsed {
+				t.Errorf("FullTextUsed = %d, want %d", plan.FullTextUsed, tt.fullUsed)
+			}
+			full := 0
+			for _, placement := range tt.placements {
+				if placement == PlacementFullText {
+					full++
+				}
+			}
+			if got := len(plan.FullTextDocuments()); got != full {
+				t.Errorf("FullTextDocuments() = %d documents, want %d", got, full)
+			}
+		})
+	}
+}
+
+func TestPlanBudgetInvalidConfig(t *testing.T) {
+	if _, err := PlanBudget(nil, nil); !errors.Is(err, ErrValidation) {
+		t.Errorf("PlanBudget(nil) error = %v, want ErrValidation", err)
+	}
+	config := NewRAGConfig("./docs")
+	config.FullTextRatio = 1.5
+	if _, err := PlanBudget(config, nil); !errors.Is(err, ErrValidation) {
+		t.Errorf("PlanBudget() error = %v, want ErrValidation", err)
+	}
+}
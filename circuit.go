@@ -0,0 +1,265 @@
+package ragclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a client's circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets every query through (normal operation)
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every query with ErrCircuitOpen without running it
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a limited number of trial queries through to
+	// decide whether to close the circuit again
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig configures the circuit breaker of a client
+//
+// After FailureThreshold consecutive failed queries the circuit opens and
+// queries fail immediately with ErrCircuitOpen. Once OpenTimeout has passed
+// the circuit is half-open: up to HalfOpenMaxProbes trial queries run, the
+// first success closes the circuit and a failure opens it again.
+//
+// Failures are execution errors, including timeouts, and missing commands.
+// Validation errors, cancelled queries and queue rejections are neither
+// failures nor successes.
+//
+// Example:
+//
+//	config := ragclient.NewRAGConfig("./docs")
+//	config.CircuitBreaker = &ragclient.CircuitBreakerConfig{
+//	    FailureThreshold: 5,
+//	    OpenTimeout:      time.Minute,
+//	    OnStateChange: func(from, to ragclient.CircuitState) {
+//	        if to == ragclient.CircuitOpen {
+//	            alert("auto-coder.rag 不可用")
+//	        }
+//	    },
+//	}
+type CircuitBreakerConfig struct {
+	// Consecutive failures that open the circuit (default: 5)
+	FailureThreshold int
+	// How long the circuit stays open before trial queries (default: 30s)
+	OpenTimeout time.Duration
+	// Trial queries allowed at once while half-open (default: 1)
+	HalfOpenMaxProbes int
+
+	// IsFailure decides whether an error counts as a failure (optional)
+	IsFailure func(err error) bool
+	// OnStateChange is called after each state change, outside of any lock
+	// of the client (optional)
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitState returns the state of the client's circuit breaker, always
+// CircuitClosed when no CircuitBreaker is configured
+func (c *RAGClient) CircuitState() CircuitState {
+	return c.breaker.state()
+}
+
+// circuitBreaker tracks the outcome of queries. A nil breaker lets every
+// query through.
+type circuitBreaker struct {
+	config *CircuitBreakerConfig
+
+	mu       sync.Mutex
+	current  CircuitState
+	failures int // consecutive failures while closed
+	openedAt time.Time
+	lastErr  error // failure that opened the circuit
+	probes   int   // trial queries running while half-open
+	// generation changes with every state change, so that queries started
+	// in an earlier state do not affect the current one
+	generation uint64
+}
+
+// circuitTransition is a state change waiting to be reported
+type circuitTransition struct {
+	from, to CircuitState
+}
+
+func newCircuitBreaker(config *CircuitBreakerConfig) *circuitBreaker {
+	if config == nil {
+		return nil
+	}
+	return &circuitBreaker{config: config, current: CircuitClosed}
+}
+
+func (b *circuitBreaker) failureThreshold() int {
+	if b.config.FailureThreshold > 0 {
+		return b.config.FailureThreshold
+	}
+	return 5
+}
+
+func (b *circuitBreaker) openTimeout() time.Duration {
+	if b.config.OpenTimeout > 0 {
+		return b.config.OpenTimeout
+	}
+	return 30 * time.Second
+}
+
+func (b *circuitBreaker) maxProbes() int {
+	if b.config.HalfOpenMaxProbes > 0 {
+		return b.config.HalfOpenMaxProbes
+	}
+	return 1
+}
+
+// state returns the current state, moving from open to half-open once the
+// open timeout has passed
+func (b *circuitBreaker) state() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	changes := b.expireLocked(nil)
+	state := b.current
+	b.mu.Unlock()
+	b.notify(changes)
+	return state
+}
+
+// allow reports whether a query may run, returning the generation to pass to
+// record or abandon once it is over. Every successful allow must be paired
+// with one of them.
+func (b *circuitBreaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	changes := b.expireLocked(nil)
+	var err error
+	switch b.current {
+	case CircuitOpen:
+		err = b.openError(time.Until(b.openedAt.Add(b.openTimeout())))
+	case CircuitHalfOpen:
+		if b.probes >= b.maxProbes() {
+			err = b.openError(0)
+		} else {
+			b.probes++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(changes)
+	return generation, err
+}
+
+// openError builds the error of a query refused while the circuit is open.
+// It must be called with mu held.
+func (b *circuitBreaker) openError(retryAfter time.Duration) *CircuitOpenError {
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	message := fmt.Sprintf("熔断器已打开, 暂停执行查询 (%v 后重试)", retryAfter.Round(time.Second))
+	if b.current == CircuitHalfOpen {
+		message = "熔断器半开, 正在等待试探查询的结果"
+	}
+	if b.lastErr != nil {
+		message += fmt.Sprintf("\n最近的错误: %v", b.lastErr)
+	}
+	return &CircuitOpenError{Message: message, RetryAfter: retryAfter, LastErr: b.lastErr}
+}
+
+// record reports the outcome of a query allowed in generation
+func (b *circuitBreaker) record(generation uint64, err error) {
+	if b == nil {
+		return
+	}
+	if err != nil && !b.isFailure(err) {
+		b.abandon(generation)
+		return
+	}
+
+	b.mu.Lock()
+	var changes []circuitTransition
+	if generation == b.generation {
+		switch {
+		case err == nil && b.current == CircuitHalfOpen:
+			b.probes--
+			changes = b.setStateLocked(CircuitClosed, changes)
+		case err == nil:
+			b.failures = 0
+		case b.current == CircuitHalfOpen:
+			b.probes--
+			b.lastErr = err
+			changes = b.setStateLocked(CircuitOpen, changes)
+		case b.current == CircuitClosed:
+			b.failures++
+			if b.failures >= b.failureThreshold() {
+				b.lastErr = err
+				changes = b.setStateLocked(CircuitOpen, changes)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// abandon ends a query allowed in generation without a verdict, e.g. when
+// it was cancelled
+func (b *circuitBreaker) abandon(generation uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.current == CircuitHalfOpen {
+		b.probes--
+	}
+}
+
+// isFailure classifies the error of a query
+func (b *circuitBreaker) isFailure(err error) bool {
+	if b.config.IsFailure != nil {
+		return b.config.IsFailure(err)
+	}
+	if errors.Is(err, ErrCanceled) || errors.Is(err, ErrValidation) {
+		return false
+	}
+	return errors.Is(err, ErrExecution) || errors.Is(err, ErrCommandNotFound)
+}
+
+// expireLocked moves an open circuit to half-open once the open timeout has
+// passed. It must be called with mu held.
+func (b *circuitBreaker) expireLocked(changes []circuitTransition) []circuitTransition {
+	if b.current == CircuitOpen && !time.Now().Before(b.openedAt.Add(b.openTimeout())) {
+		changes = b.setStateLocked(CircuitHalfOpen, changes)
+	}
+	return changes
+}
+
+// setStateLocked changes the state and appends the transition to changes.
+// It must be called with mu held.
+func (b *circuitBreaker) setStateLocked(state CircuitState, changes []circuitTransition) []circuitTransition {
+	changes = append(changes, circuitTransition{from: b.current, to: state})
+	b.current = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	if state == CircuitOpen {
+		b.openedAt = time.Now()
+	}
+	if state == CircuitClosed {
+		b.lastErr = nil
+	}
+	return changes
+}
+
+// notify reports state changes to OnStateChange
+func (b *circuitBreaker) notify(changes []circuitTransition) {
+	if b.config.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		b.config.OnStateChange(change.from, change.to)
+	}
+}
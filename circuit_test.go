@@ -0,0 +1,267 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingExecutor counts the processes started by the wrapped executor
+type countingExecutor struct {
+	Executor
+	started atomic.Int32
+}
+
+func (e *countingExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	e.started.Add(1)
+	return e.Executor.Start(ctx, req)
+}
+
+// openBreaker returns a breaker opened by FailureThreshold failures
+func openBreaker(t *testing.T, config *CircuitBreakerConfig) *circuitBreaker {
+	t.Helper()
+	b := newCircuitBreaker(config)
+	for i := 0; i < b.failureThreshold(); i++ {
+		generation, err := b.allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.record(generation, &ExecutionError{Message: "失败"})
+	}
+	if state := b.state(); state != CircuitOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+	return b
+}
+
+// halfOpenBreaker returns a breaker whose open timeout has passed
+func halfOpenBreaker(t *testing.T, config *CircuitBreakerConfig) *circuitBreaker {
+	t.Helper()
+	config.OpenTimeout = time.Millisecond
+	b := openBreaker(t, config)
+	time.Sleep(5 * time.Millisecond)
+	if state := b.state(); state != CircuitHalfOpen {
+		t.Fatalf("state = %s, want half_open", state)
+	}
+	return b
+}
+
+func TestCircuitBreakerOpensAfterFailures(t *testing.T) {
+	executor := &countingExecutor{Executor: &scriptedExecutor{stderr: "ValueError", exitCode: 1}}
+	client := newScriptedClient(t, executor)
+	client.config.CircuitBreaker = &CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute}
+	client.breaker = newCircuitBreaker(client.config.CircuitBreaker)
+
+	for i := 0; i < 3; i++ {
+		if state := client.CircuitState(); state != CircuitClosed {
+			t.Fatalf("state after %d failures = %s, want closed", i, state)
+		}
+		if _, err := client.Query("问题", nil); !errors.Is(err, ErrExecution) {
+			t.Fatalf("Query() error = %v, want ErrExecution", err)
+		}
+	}
+	if state := client.CircuitState(); state != CircuitOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+
+	_, err := client.Query("问题", nil)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Query() error = %v, want a CircuitOpenError", err)
+	}
+	if openErr.RetryAfter <= 0 || openErr.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want at most the open timeout", openErr.RetryAfter)
+	}
+	if !errors.Is(openErr.LastErr, ErrExecution) {
+		t.Errorf("LastErr = %v, want the failure that opened the circuit", openErr.LastErr)
+	}
+	if started := executor.started.Load(); started != 3 {
+		t.Errorf("%d processes started, want 3", started)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker(&CircuitBreakerConfig{FailureThreshold: 2})
+	for _, err := range []error{&ExecutionError{}, nil, &ExecutionError{}} {
+		generation, allowErr := b.allow()
+		if allowErr != nil {
+			t.Fatal(allowErr)
+		}
+		b.record(generation, err)
+	}
+	if state := b.state(); state != CircuitClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxProbes int
+		result    error // outcome of the probes
+		want      CircuitState
+	}{
+		{name: "probe succeeds", maxProbes: 1, want: CircuitClosed},
+		{name: "probe fails", maxProbes: 1, result: &ExecutionError{Message: "仍然失败"}, want: CircuitOpen},
+		{name: "two probes", maxProbes: 2, want: CircuitClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := halfOpenBreaker(t, &CircuitBreakerConfig{FailureThreshold: 1, HalfOpenMaxProbes: tt.maxProbes})
+
+			var generations []uint64
+			for i := 0; i < tt.maxProbes; i++ {
+				generation, err := b.allow()
+				if err != nil {
+					t.Fatalf("probe %d refused: %v", i, err)
+				}
+				generations = append(generations, generation)
+			}
+			_, err := b.allow()
+			var openErr *CircuitOpenError
+			if !errors.As(err, &openErr) || openErr.RetryAfter != 0 {
+				t.Fatalf("allow() beyond the probe limit = %v, want a CircuitOpenError with RetryAfter 0", err)
+			}
+
+			b.record(generations[0], tt.result)
+			if state := b.state(); state != tt.want {
+				t.Errorf("state = %s, want %s", state, tt.want)
+			}
+			if tt.want == CircuitOpen {
+				if _, err := b.allow(); !errors.As(err, &openErr) || openErr.LastErr != tt.result {
+					t.Errorf("allow() = %v, want a CircuitOpenError for the failed probe", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresCanceledQueries(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceledErr := newCanceledError(canceled)
+
+	t.Run("closed", func(t *testing.T) {
+		b := newCircuitBreaker(&CircuitBreakerConfig{FailureThreshold: 1})
+		generation, err := b.allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.record(generation, canceledErr)
+		if state := b.state(); state != CircuitClosed {
+			t.Errorf("state = %s, want closed", state)
+		}
+	})
+
+	t.Run("half-open", func(t *testing.T) {
+		b := halfOpenBreaker(t, &CircuitBreakerConfig{FailureThreshold: 1})
+		generation, err := b.allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.record(generation, canceledErr)
+		if state := b.state(); state != CircuitHalfOpen {
+			t.Errorf("state = %s, want half_open", state)
+		}
+		// 被取消的试探查询释放了名额
+		if _, err := b.allow(); err != nil {
+			t.Errorf("allow() after a cancelled probe = %v, want nil", err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		client := newScriptedClient(t, &scriptedExecutor{stdout: "答案\n"})
+		client.breaker = newCircuitBreaker(&CircuitBreakerConfig{FailureThreshold: 1})
+		if _, err := client.QueryContext(canceled, "问题", nil); !errors.Is(err, ErrCanceled) {
+			t.Fatalf("QueryContext() error = %v, want ErrCanceled", err)
+		}
+		if state := client.CircuitState(); state != CircuitClosed {
+			t.Errorf("state = %s, want closed", state)
+		}
+	})
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	t.Run("success after opening", func(t *testing.T) {
+		b := newCircuitBreaker(&CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+		stale, _ := b.allow()
+		generation, _ := b.allow()
+		b.record(generation, &ExecutionError{})
+
+		b.record(stale, nil)
+		if state := b.state(); state != CircuitOpen {
+			t.Errorf("state = %s, want open", state)
+		}
+	})
+
+	t.Run("failure while half-open", func(t *testing.T) {
+		config := &CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Millisecond}
+		b := newCircuitBreaker(config)
+		stale, _ := b.allow()
+		generation, _ := b.allow()
+		b.record(generation, &ExecutionError{})
+		time.Sleep(5 * time.Millisecond)
+		if _, err := b.allow(); err != nil {
+			t.Fatal(err)
+		}
+
+		b.record(stale, &ExecutionError{})
+		b.abandon(stale)
+		if state := b.state(); state != CircuitHalfOpen {
+			t.Errorf("state = %s, want half_open", state)
+		}
+		// 旧查询不应释放试探查询的名额
+		if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("allow() = %v, want ErrCircuitOpen while the probe runs", err)
+		}
+	})
+}
+
+func TestCircuitBreakerOnStateChange(t *testing.T) {
+	var mu sync.Mutex
+	var changes []circuitTransition
+	var b *circuitBreaker
+	config := &CircuitBreakerConfig{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Millisecond,
+		OnStateChange: func(from, to CircuitState) {
+			// 在锁内调用会死锁
+			b.state()
+			mu.Lock()
+			changes = append(changes, circuitTransition{from: from, to: to})
+			mu.Unlock()
+		},
+	}
+	b = newCircuitBreaker(config)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		generation, _ := b.allow()
+		b.record(generation, &ExecutionError{})
+		time.Sleep(5 * time.Millisecond)
+		generation, _ = b.allow()
+		b.record(generation, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnStateChange was called with the lock held")
+	}
+
+	want := []circuitTransition{
+		{from: CircuitClosed, to: CircuitOpen},
+		{from: CircuitOpen, to: CircuitHalfOpen},
+		{from: CircuitHalfOpen, to: CircuitClosed},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
@@ -1,23 +1,31 @@
 package ragclient
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // RAGClient is the main client for interacting with auto-coder.rag run
 type RAGClient struct {
 	config *RAGConfig
+
+	mu       sync.Mutex
+	inFlight int
+	closed   bool
+	// Queries waiting for a slot when MaxConcurrency is reached
+	queue    []*waiter
+	rejected uint64
+	// Circuit breaker, nil unless configured
+	breaker *circuitBreaker
+	// Document directory created by the SDK, removed by Close
+	ownedDocDir string
 }
 
 // NewRAGClient creates a new RAG client
@@ -32,23 +40,54 @@ func NewRAGClientWithConfig(config *RAGConfig) (*RAGClient, error) {
 	}
 
 	return &RAGClient{
-		config: config,
+		config:  config,
+		breaker: newCircuitBreaker(config.CircuitBreaker),
 	}, nil
 }
 
 // GetDocDir returns the document directory path
 //
-// Useful for debugging or manual cleanup of temp directories.
+// Useful for debugging.
 func (c *RAGClient) GetDocDir() string {
 	return c.config.DocDir
 }
 
+// Close releases the resources held by the client
+//
+// For clients created by NewRAGClientFromText or NewRAGClientFromTexts, the
+// document directory is removed if the SDK created it. A tempDir that already
+// existed is left untouched. Close fails with ErrClientBusy while queries are
+// still running, and queries started after Close fail with ErrClientClosed.
+// Calling Close more than once is safe.
+func (c *RAGClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		if c.inFlight > 0 {
+			return &RAGError{
+				Message: fmt.Sprintf("仍有 %d 个查询正在执行, 无法关闭客户端", c.inFlight),
+				Err:     ErrClientBusy,
+			}
+		}
+		c.closed = true
+	}
+
+	if c.ownedDocDir != "" {
+		if err := os.RemoveAll(c.ownedDocDir); err != nil {
+			return &RAGError{Message: fmt.Sprintf("Failed to remove directory: %v", err), Err: err}
+		}
+		c.ownedDocDir = ""
+	}
+	return nil
+}
+
 // NewRAGClientFromText creates a RAG client from text content
 //
 // Creates a temporary directory with the text content as a document file,
 // then initializes a client based on that directory.
-// The temporary directory will NOT be automatically cleaned up.
-// Use client.GetDocDir() to get the path for manual cleanup.
+// Call client.Close() to remove the temporary directory when done.
+// If tempDir is given and already exists, it is never removed.
 //
 // Example:
 //
@@ -56,13 +95,11 @@ func (c *RAGClient) GetDocDir() string {
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
+//	defer client.Close()
 //	answer, err := client.Query("Question?", nil)
 //
-//	// Get temp directory path (for debugging or manual cleanup)
+//	// Get temp directory path (for debugging)
 //	fmt.Println("Doc directory:", client.GetDocDir())
-//
-//	// Manual cleanup
-//	os.RemoveAll(client.GetDocDir())
 func NewRAGClientFromText(text string, filename string, tempDir string) (*RAGClient, error) {
 	// Validate text content
 	if strings.TrimSpace(text) == "" {
@@ -73,37 +110,16 @@ func NewRAGClientFromText(text string, filename string, tempDir string) (*RAGCli
 		filename = "document.md"
 	}
 
-	// Create directory
-	var docPath string
-	var err error
-	if tempDir != "" {
-		docPath = tempDir
-		if err := os.MkdirAll(docPath, 0755); err != nil {
-			return nil, &RAGError{Message: fmt.Sprintf("Failed to create directory: %v", err)}
-		}
-	} else {
-		docPath, err = os.MkdirTemp("", "rag_text_")
-		if err != nil {
-			return nil, &RAGError{Message: fmt.Sprintf("Failed to create temp directory: %v", err)}
-		}
-	}
-
-	// Write file
-	filePath := docPath + "/" + filename
-	if err := os.WriteFile(filePath, []byte(text), 0644); err != nil {
-		return nil, &RAGError{Message: fmt.Sprintf("Failed to write file: %v", err)}
-	}
-
-	// Create and return client
-	return NewRAGClient(docPath)
+	docs := []TextDocument{{Content: text, Filename: filename}}
+	return newRAGClientFromDocuments(docs, tempDir, "rag_text_")
 }
 
 // NewRAGClientFromTexts creates a RAG client from multiple text documents
 //
 // Creates a temporary directory with multiple document files,
 // then initializes a client based on that directory.
-// The temporary directory will NOT be automatically cleaned up.
-// Use client.GetDocDir() to get the path for manual cleanup.
+// Call client.Close() to remove the temporary directory when done.
+// If tempDir is given and already exists, it is never removed.
 //
 // Example:
 //
@@ -117,6 +133,7 @@ func NewRAGClientFromText(text string, filename string, tempDir string) (*RAGCli
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
+//	defer client.Close()
 //	answer, err := client.Query("How to use the API?", nil)
 //
 //	// Get temp directory path
@@ -137,110 +154,158 @@ func NewRAGClientFromTexts(texts []TextDocument, tempDir string) (*RAGClient, er
 		}
 	}
 
-	// Create directory
-	var docPath string
-	var err error
-	if tempDir != "" {
-		docPath = tempDir
-		if err := os.MkdirAll(docPath, 0755); err != nil {
-			return nil, &RAGError{Message: fmt.Sprintf("Failed to create directory: %v", err)}
-		}
-	} else {
-		docPath, err = os.MkdirTemp("", "rag_texts_")
-		if err != nil {
-			return nil, &RAGError{Message: fmt.Sprintf("Failed to create temp directory: %v", err)}
-		}
-	}
+	return newRAGClientFromDocuments(texts, tempDir, "rag_texts_")
+}
 
-	// Write all files
-	for i, doc := range texts {
-		filename := doc.Filename
-		if filename == "" {
-			filename = fmt.Sprintf("doc_%d.md", i)
-		}
+// validateConfig checks a configuration before a client is created. Unlike
+// Validate it does not require CommandPath to resolve, a missing command is
+// reported by CheckAvailability and by the queries themselves.
+func validateConfig(config *RAGConfig) error {
+	return config.validate(false)
+}
 
-		filePath := docPath + "/" + filename
-		if err := os.WriteFile(filePath, []byte(doc.Content), 0644); err != nil {
-			return nil, &RAGError{Message: fmt.Sprintf("Failed to write file %s: %v", filename, err)}
+// validateQueryOptions validates the per-query RAG parameter overrides,
+// combined with the config values they override
+func validateQueryOptions(config *RAGConfig, options *RAGQueryOptions) error {
+	params := resolveRAGParams(config, options)
+	if err := validateRAGParams(params.ContextWindowLimit, params.FullTextRatio, params.SegmentRatio, params.DocFilterRelevance); err != nil {
+		return err
+	}
+	// 比例之和按合并后的实际值检查
+	if err := ratioSumError(params.FullTextRatio, params.SegmentRatio); err != nil {
+		return err
+	}
+	if options != nil {
+		if errs := retryPolicyErrors(options.RetryPolicy); len(errs) > 0 {
+			return errs[0]
 		}
 	}
+	return nil
+}
 
-	// Create and return client
-	return NewRAGClient(docPath)
+// ragParams holds the RAG tuning parameters in effect for a query
+type ragParams struct {
+	ContextWindowLimit int
+	FullTextRatio      float64
+	SegmentRatio       float64
+	DocFilterRelevance float64
 }
 
-func validateConfig(config *RAGConfig) error {
-	// 验证文档目录存在
-	if _, err := os.Stat(config.DocDir); os.IsNotExist(err) {
-		return &ValidationError{Message: fmt.Sprintf("文档目录不存在: %s", config.DocDir)}
+// resolveRAGParams applies the query overrides on top of the config values
+func resolveRAGParams(config *RAGConfig, options *RAGQueryOptions) ragParams {
+	params := ragParams{
+		ContextWindowLimit: config.RagContextWindowLimit,
+		FullTextRatio:      config.FullTextRatio,
+		SegmentRatio:       config.SegmentRatio,
+		DocFilterRelevance: config.RagDocFilterRelevance,
 	}
-
-	// 验证产品模式
-	if config.ProductMode != "lite" && config.ProductMode != "pro" {
-		return &ValidationError{Message: fmt.Sprintf("不支持的产品模式: %s", config.ProductMode)}
+	if options == nil {
+		return params
+	}
+	if options.RagContextWindowLimit != nil {
+		params.ContextWindowLimit = *options.RagContextWindowLimit
+	}
+	if options.FullTextRatio != nil {
+		params.FullTextRatio = *options.FullTextRatio
 	}
+	if options.SegmentRatio != nil {
+		params.SegmentRatio = *options.SegmentRatio
+	}
+	if options.RagDocFilterRelevance != nil {
+		params.DocFilterRelevance = *options.RagDocFilterRelevance
+	}
+	return params
+}
 
+// validateRAGParams checks the numeric RAG tuning parameters are in range,
+// returning the first problem found
+func validateRAGParams(contextWindowLimit int, fullTextRatio float64, segmentRatio float64, docFilterRelevance float64) error {
+	if errs := ragParamErrors(contextWindowLimit, fullTextRatio, segmentRatio, docFilterRelevance); len(errs) > 0 {
+		return errs[0]
+	}
 	return nil
 }
 
 // buildEnv builds the environment variables for subprocess
 // Merge priority (low to high):
-// 1. os.Environ (system environment)
+// 1. os.Environ (system environment), filtered by config.EnvMode
 // 2. config.WindowsUtf8Env (Windows UTF-8 auto-config)
 // 3. config.Envs (global config)
 // 4. options.Envs (single query config)
 func (c *RAGClient) buildEnv(options *RAGQueryOptions) []string {
-	env := os.Environ()
-	envMap := make(map[string]string)
-
-	// 1. Parse system environment
-	for _, e := range env {
-		parts := strings.SplitN(e, "=", 2)
-		if len(parts) == 2 {
-			envMap[parts[0]] = parts[1]
-		}
+	var queryEnvs map[string]string
+	if options != nil {
+		queryEnvs = options.Envs
 	}
+	base := baseEnv(c.config.EnvMode, c.config.EnvAllowlist)
+	return mergeEnv(base, c.config.WindowsUtf8Env, c.config.Envs, queryEnvs)
+}
+
+// Query executes a RAG query and returns the complete answer
+func (c *RAGClient) Query(question string, options *RAGQueryOptions) (string, error) {
+	return c.QueryContext(context.Background(), question, options)
+}
 
-	// 2. Windows UTF-8 auto-config
-	if c.config.WindowsUtf8Env && runtime.GOOS == "windows" {
-		envMap["PYTHONIOENCODING"] = "utf-8"
-		envMap["LANG"] = "zh_CN.UTF-8"
-		envMap["LC_ALL"] = "zh_CN.UTF-8"
-		envMap["CHCP"] = "65001"
+// QueryContext executes a RAG query bound to ctx and returns the complete answer
+//
+// The configured timeout still applies on top of ctx. When ctx is cancelled or
+// its deadline expires, the auto-coder.rag process is killed and a
+// *CanceledError is returned. Failed attempts are retried according to the
+// RetryPolicy of options or config, the timeout applying to each attempt; a
+// query that still fails after a retry returns a *RetryError. A query that
+// succeeds after retries only returns the answer: use QueryCollectMessages or
+// OpenStream when the attempts are needed on success, or RetryPolicy.OnRetry
+// to observe each failed attempt.
+func (c *RAGClient) QueryContext(ctx context.Context, question string, options *RAGQueryOptions) (string, error) {
+	if options == nil {
+		options = &RAGQueryOptions{OutputFormat: "text"}
 	}
 
-	// 3. Global config
-	if c.config.Envs != nil {
-		for k, v := range c.config.Envs {
-			envMap[k] = v
-		}
+	// 验证输出格式
+	if options.OutputFormat != "text" && options.OutputFormat != "json" && options.OutputFormat != "stream-json" {
+		return "", &ValidationError{Message: fmt.Sprintf("不支持的输出格式: %s", options.OutputFormat)}
 	}
 
-	// 4. Single query config (highest priority)
-	if options != nil && options.Envs != nil {
-		for k, v := range options.Envs {
-			envMap[k] = v
-		}
+	if err := validateQueryOptions(c.config, options); err != nil {
+		return "", err
+	}
+
+	if ctx.Err() != nil {
+		return "", newCanceledError(ctx)
 	}
 
-	// Convert back to []string
-	result := make([]string, 0, len(envMap))
-	for k, v := range envMap {
-		result = append(result, k+"="+v)
+	policy := resolveRetryPolicy(c.config, options)
+	var attempts []AttemptInfo
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		answer, err := c.queryOnce(ctx, question, options)
+		attempts = append(attempts, AttemptInfo{Start: start, Duration: time.Since(start), Err: err})
+		if err == nil || !policy.shouldRetry(ctx, attempt, err) {
+			if err != nil && attempt > 1 {
+				err = &RetryError{Attempts: attempts, Err: err}
+			}
+			return answer, err
+		}
+		delay := policy.backoff(attempt)
+		policy.notify(attempt, err, delay)
+		if !sleepContext(ctx, delay, nil) {
+			return "", &RetryError{Attempts: attempts, Err: newCanceledError(ctx)}
+		}
 	}
-	return result
 }
 
-// Query executes a RAG query and returns the complete answer
-func (c *RAGClient) Query(question string, options *RAGQueryOptions) (string, error) {
-	if options == nil {
-		options = &RAGQueryOptions{OutputFormat: "text"}
+// queryOnce runs a single attempt of QueryContext
+func (c *RAGClient) queryOnce(ctx context.Context, question string, options *RAGQueryOptions) (answer string, err error) {
+	generation, err := c.breaker.allow()
+	if err != nil {
+		return "", err
 	}
+	defer func() { c.breaker.record(generation, err) }()
 
-	// 验证输出格式
-	if options.OutputFormat != "text" && options.OutputFormat != "json" && options.OutputFormat != "stream-json" {
-		return "", &ValidationError{Message: fmt.Sprintf("不支持的输出格式: %s", options.OutputFormat)}
+	if err := c.acquire(ctx, options); err != nil {
+		return "", err
 	}
+	defer c.release()
 
 	// 获取超时时间
 	timeout := c.config.Timeout
@@ -250,34 +315,48 @@ func (c *RAGClient) Query(question string, options *RAGQueryOptions) (string, er
 
 	cmd := c.buildCommand(options)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	execCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
-	execCmd.Env = c.buildEnv(options)
-
-	// 设置输入
-	execCmd.Stdin = strings.NewReader(question)
+	req := &ExecRequest{
+		Args:  cmd,
+		Env:   c.buildEnv(options),
+		Stdin: strings.NewReader(question),
+	}
 
-	// 执行命令
-	output, err := execCmd.CombinedOutput()
+	// 执行命令, 分别收集 stdout 与 stderr
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	exitCode, err := runProcess(runCtx, c.executor(), req, &stdout, &stderr)
+	duration := time.Since(start)
 
+	if ctx.Err() != nil {
+		return "", newCanceledError(ctx)
+	}
+	if runCtx.Err() == context.DeadlineExceeded {
+		return "", newTimeoutError(TimeoutTotal, timeout, cmd, exitCode, stdout.String(), stderr.String(), duration)
+	}
 	if err != nil {
-		if execCmd.ProcessState != nil {
-			exitCode := execCmd.ProcessState.ExitCode()
-			return "", &ExecutionError{
-				Message:  string(output),
-				ExitCode: exitCode,
-			}
-		}
-		return "", &RAGError{Message: fmt.Sprintf("执行查询时发生错误: %v", err)}
+		return "", newStartError(fmt.Sprintf("执行查询时发生错误: %v", err), cmd[0], err)
+	}
+	if exitCode != 0 {
+		return "", newExecutionError(cmd, exitCode, stdout.String(), stderr.String(), duration)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return strings.TrimSpace(stdout.String()), nil
 }
 
 // QueryStream executes a RAG query and streams the results
 func (c *RAGClient) QueryStream(question string, options *RAGQueryOptions) (<-chan string, <-chan error) {
+	return c.QueryStreamContext(context.Background(), question, options)
+}
+
+// QueryStreamContext executes a RAG query bound to ctx and streams the results
+//
+// When ctx is cancelled the process is killed, both channels are closed and
+// a *CanceledError is sent on the error channel. Consumers that stop reading
+// early should cancel ctx so the producer goroutine can exit.
+func (c *RAGClient) QueryStreamContext(ctx context.Context, question string, options *RAGQueryOptions) (<-chan string, <-chan error) {
 	resultChan := make(chan string, 100)
 	errorChan := make(chan error, 1)
 
@@ -289,81 +368,28 @@ func (c *RAGClient) QueryStream(question string, options *RAGQueryOptions) (<-ch
 			options = &RAGQueryOptions{OutputFormat: "text"}
 		}
 
-		cmd := c.buildCommand(options)
-
-		execCmd := exec.Command(cmd[0], cmd[1:]...)
-		execCmd.Env = c.buildEnv(options)
-
-		// 设置输入
-		stdin, err := execCmd.StdinPipe()
+		lines, err := c.startRetryLineStream(ctx, question, options)
 		if err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("创建stdin失败: %v", err)}
+			errorChan <- err
 			return
 		}
 
-		// 设置输出
-		stdout, err := execCmd.StdoutPipe()
-		if err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("创建stdout失败: %v", err)}
-			return
-		}
-
-		// 设置错误输出
-		stderr, err := execCmd.StderrPipe()
-		if err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("创建stderr失败: %v", err)}
-			return
-		}
-
-		// 启动命令
-		if err := execCmd.Start(); err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("启动命令失败: %v (命令: %s)", err, cmd[0])}
-			return
-		}
-
-		// 写入问题
-		go func() {
-			defer stdin.Close()
-			stdin.Write([]byte(question))
-		}()
-
-		// 异步读取 stderr
-		var stderrOutput []byte
-		go func() {
-			stderrOutput, _ = io.ReadAll(stderr)
-		}()
-
-		// 流式读取输出
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			resultChan <- scanner.Text()
-		}
-
-		if err := scanner.Err(); err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("读取输出失败: %v", err)}
-			return
+	loop:
+		for {
+			line, ok := lines.next()
+			if !ok {
+				break
+			}
+			lines.commit()
+			select {
+			case resultChan <- line:
+			case <-ctx.Done():
+				break loop
+			}
 		}
 
-		// 等待命令完成
-		if err := execCmd.Wait(); err != nil {
-			stderrStr := strings.TrimSpace(string(stderrOutput))
-			if execCmd.ProcessState != nil {
-				exitCode := execCmd.ProcessState.ExitCode()
-				errMsg := fmt.Sprintf("命令执行失败 (退出码: %d, 命令: %s)", exitCode, cmd[0])
-				if stderrStr != "" {
-					errMsg += fmt.Sprintf("\n错误输出: %s", stderrStr)
-				}
-				errorChan <- &ExecutionError{
-					Message:  errMsg,
-					ExitCode: exitCode,
-				}
-			} else {
-				errMsg := fmt.Sprintf("命令执行失败: %v (命令: %s)", err, cmd[0])
-				if stderrStr != "" {
-					errMsg += fmt.Sprintf("\n错误输出: %s", stderrStr)
-				}
-				errorChan <- &RAGError{Message: errMsg}
-			}
+		if err := lines.close(); err != nil {
+			errorChan <- err
 		}
 	}()
 
@@ -371,7 +397,17 @@ func (c *RAGClient) QueryStream(question string, options *RAGQueryOptions) (<-ch
 }
 
 // QueryStreamMessages executes a RAG query and returns Message objects stream
+//
+// Consumers that may stop reading early should prefer OpenStream, which does
+// not leave a producer goroutine behind.
 func (c *RAGClient) QueryStreamMessages(question string, options *RAGQueryOptions) (<-chan *Message, <-chan error) {
+	return c.QueryStreamMessagesContext(context.Background(), question, options)
+}
+
+// QueryStreamMessagesContext executes a RAG query bound to ctx and returns Message objects stream
+//
+// Cancellation behaves as in QueryStreamContext.
+func (c *RAGClient) QueryStreamMessagesContext(ctx context.Context, question string, options *RAGQueryOptions) (<-chan *Message, <-chan error) {
 	messageChan := make(chan *Message, 100)
 	errorChan := make(chan error, 1)
 
@@ -379,137 +415,161 @@ func (c *RAGClient) QueryStreamMessages(question string, options *RAGQueryOption
 		defer close(messageChan)
 		defer close(errorChan)
 
-		if options == nil {
-			options = &RAGQueryOptions{OutputFormat: "stream-json"}
-		} else {
-			// Ensure using stream-json format
-			options = &RAGQueryOptions{
-				OutputFormat: "stream-json",
-				Agentic:      options.Agentic,
-				ProductMode:  options.ProductMode,
-				Model:        options.Model,
-				Timeout:      options.Timeout,
-			}
-		}
-
-		cmd := c.buildCommand(options)
-
-		execCmd := exec.Command(cmd[0], cmd[1:]...)
-		execCmd.Env = c.buildEnv(options)
-
-		// Set up input
-		stdin, err := execCmd.StdinPipe()
+		stream, err := c.OpenStream(ctx, question, options)
 		if err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("创建stdin失败: %v", err)}
+			errorChan <- err
 			return
 		}
 
-		// Set up output
-		stdout, err := execCmd.StdoutPipe()
-		if err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("创建stdout失败: %v", err)}
-			return
-		}
-
-		// Start command
-		if err := execCmd.Start(); err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("启动命令失败: %v", err)}
-			return
-		}
-
-		// Write question
-		go func() {
-			defer stdin.Close()
-			stdin.Write([]byte(question))
-		}()
-
-		// Stream read output
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" {
-				continue
-			}
-
-			message := &Message{}
-			if err := message.FromJSON(line); err != nil {
-				// Skip invalid JSON lines
-				continue
+	loop:
+		for stream.Next() {
+			select {
+			case messageChan <- stream.Message():
+			case <-ctx.Done():
+				break loop
 			}
-			messageChan <- message
 		}
 
-		if err := scanner.Err(); err != nil {
-			errorChan <- &RAGError{Message: fmt.Sprintf("读取输出失败: %v", err)}
-			return
-		}
-
-		// Wait for command completion
-		if err := execCmd.Wait(); err != nil {
-			if execCmd.ProcessState != nil {
-				errorChan <- &ExecutionError{
-					Message:  fmt.Sprintf("命令执行失败"),
-					ExitCode: execCmd.ProcessState.ExitCode(),
-				}
-			} else {
-				errorChan <- &RAGError{Message: fmt.Sprintf("命令执行失败: %v", err)}
-			}
+		if err := stream.Close(); err != nil {
+			errorChan <- err
 		}
 	}()
 
 	return messageChan, errorChan
 }
 
+// newExecutionError builds an ExecutionError for a command that exited with a
+// non-zero code, keeping both output streams for diagnostics
+func newExecutionError(cmd []string, exitCode int, stdout string, stderr string, duration time.Duration) *ExecutionError {
+	errMsg := fmt.Sprintf("命令执行失败 (退出码: %d, 命令: %s)", exitCode, cmd[0])
+	if stderrStr := strings.TrimSpace(stderr); stderrStr != "" {
+		errMsg += fmt.Sprintf("\n错误输出: %s", stderrStr)
+	}
+	return &ExecutionError{
+		Message:  errMsg,
+		ExitCode: exitCode,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Command:  cmd,
+		Duration: duration,
+	}
+}
+
+// newTimeoutError builds an ExecutionError for a command that was killed
+// because the limit of the given kind, in seconds, expired
+func newTimeoutError(kind TimeoutKind, limit int, cmd []string, exitCode int, stdout string, stderr string, duration time.Duration) *ExecutionError {
+	execErr := newExecutionError(cmd, exitCode, stdout, stderr, duration)
+	execErr.TimedOut = true
+	execErr.TimeoutKind = kind
+	switch kind {
+	case TimeoutFirstByte:
+		execErr.Message = fmt.Sprintf("等待首条输出超时 (%d秒, 命令: %s)", limit, cmd[0])
+	case TimeoutIdle:
+		execErr.Message = fmt.Sprintf("输出空闲超时 (%d秒无输出, 命令: %s)", limit, cmd[0])
+	default:
+		execErr.Message = fmt.Sprintf("查询超时 (%d秒, 命令: %s)", limit, cmd[0])
+	}
+	if stderrStr := strings.TrimSpace(stderr); stderrStr != "" {
+		execErr.Message += fmt.Sprintf("\n错误输出: %s", stderrStr)
+	}
+	return execErr
+}
+
 // QueryCollectMessages executes a query and returns a RAGResponse with Message stream
 func (c *RAGClient) QueryCollectMessages(question string, options *RAGQueryOptions) (*RAGResponse, error) {
-	var contentParts []string
-	var contexts []string
-	var metadata map[string]interface{}
-	tokensInfo := map[string]int{"input": 0, "generated": 0}
+	start := time.Now()
 
-	messageChan, errorChan := c.QueryStreamMessages(question, options)
+	lines, err := c.startRetryLineStream(context.Background(), question, streamJSONOptions(options))
+	if err != nil {
+		return &RAGResponse{
+			Success:  false,
+			Answer:   "",
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Attempts: lines.attemptList(),
+		}, err
+	}
+	stream := &Stream{lines: lines}
+	defer stream.Close()
 
-	for {
-		select {
-		case message, ok := <-messageChan:
-			if !ok {
-				// Channel closed, build response
-				answer := strings.Join(contentParts, "")
-				
-				// Add token info to metadata
-				if metadata == nil {
-					metadata = make(map[string]interface{})
-				}
-				metadata["tokens"] = tokensInfo
-
-				return &RAGResponse{
-					Success:  true,
-					Answer:   answer,
-					Contexts: contexts,
-					Error:    "",
-				}, nil
-			}
+	var contentParts []string
+	response := &RAGResponse{}
+
+	// 重试时丢弃失败的尝试已经输出的事件, 只保留最后一次尝试的结果
+	attempt := lines.attempt()
+	resetOnRetry := func() {
+		if n := lines.attempt(); n != attempt {
+			attempt = n
+			contentParts = nil
+			response = &RAGResponse{}
+		}
+	}
 
-			if message.IsContent() {
-				contentParts = append(contentParts, message.GetContent())
-			} else if message.IsContexts() {
-				contexts = append(contexts, message.GetContexts()...)
-			} else if message.IsEnd() {
-				metadata = message.GetMetadata()
-			} else if tokens := message.GetTokens(); tokens != nil {
-				tokensInfo["input"] += tokens.Input
-				tokensInfo["generated"] += tokens.Generated
-			}
+	for stream.Next() {
+		message := stream.Message()
+		resetOnRetry()
 
-		case err, ok := <-errorChan:
-			if ok && err != nil {
-				return &RAGResponse{
-					Success: false,
-					Answer:  "",
-					Error:   err.Error(),
-				}, err
-			}
+		// 所有事件都可能携带 token 信息
+		if tokens := message.GetTokens(); tokens != nil {
+			response.Tokens.Input += tokens.Input
+			response.Tokens.Generated += tokens.Generated
 		}
+
+		switch {
+		case message.IsContent():
+			contentParts = append(contentParts, message.GetContent())
+		case message.IsContexts():
+			response.Contexts = append(response.Contexts, message.GetContexts()...)
+		case message.IsStage():
+			response.Stages = trackStage(response.Stages, message)
+		case message.IsEnd():
+			response.Metadata = message.GetMetadata()
+			closeLastStage(response.Stages, message.Timestamp)
+		}
+	}
+	// 最后一次尝试可能没有输出任何事件
+	resetOnRetry()
+	closeLastStage(response.Stages, time.Now())
+
+	response.Answer = strings.Join(contentParts, "")
+	response.Duration = time.Since(start)
+
+	err = stream.Close()
+	response.Command = stream.Command()
+	response.Attempts = stream.Attempts()
+	if err != nil {
+		response.Success = false
+		response.Error = err.Error()
+		return response, err
+	}
+
+	response.Success = true
+	return response, nil
+}
+
+// trackStage records a stage event, closing the previous stage when a new
+// stage type begins. Repeated events for the same stage update its status.
+func trackStage(stages []StageInfo, message *Message) []StageInfo {
+	stageType := message.GetStageType()
+	if n := len(stages); n > 0 && stages[n-1].Type == stageType {
+		stages[n-1].Status = message.GetStatus()
+		stages[n-1].Message = message.GetMessage()
+		return stages
+	}
+
+	closeLastStage(stages, message.Timestamp)
+	return append(stages, StageInfo{
+		Type:      stageType,
+		Status:    message.GetStatus(),
+		Message:   message.GetMessage(),
+		StartTime: message.Timestamp,
+	})
+}
+
+// closeLastStage sets the duration of the last stage if it is still open
+func closeLastStage(stages []StageInfo, end time.Time) {
+	if n := len(stages); n > 0 && stages[n-1].Duration == 0 && end.After(stages[n-1].StartTime) {
+		stages[n-1].Duration = end.Sub(stages[n-1].StartTime)
 	}
 }
 
@@ -562,40 +622,88 @@ func (c *RAGClient) buildCommand(options *RAGQueryOptions) []string {
 	}
 
 	// RAG 参数
+	params := resolveRAGParams(c.config, options)
 	cmd = append(cmd,
-		"--rag_context_window_limit", strconv.Itoa(c.config.RagContextWindowLimit),
-		"--full_text_ratio", fmt.Sprintf("%.1f", c.config.FullTextRatio),
-		"--segment_ratio", fmt.Sprintf("%.1f", c.config.SegmentRatio),
-		"--rag_doc_filter_relevance", fmt.Sprintf("%d", int(c.config.RagDocFilterRelevance)),
+		"--rag_context_window_limit", strconv.Itoa(params.ContextWindowLimit),
+		"--full_text_ratio", formatFloatFlag(params.FullTextRatio),
+		"--segment_ratio", formatFloatFlag(params.SegmentRatio),
+		"--rag_doc_filter_relevance", formatFloatFlag(params.DocFilterRelevance),
 	)
 
 	// 索引选项
-	if c.config.EnableHybridIndex {
+	enableHybridIndex := c.config.EnableHybridIndex
+	if options.EnableHybridIndex != nil {
+		enableHybridIndex = *options.EnableHybridIndex
+	}
+	disableAutoWindow := c.config.DisableAutoWindow
+	if options.DisableAutoWindow != nil {
+		disableAutoWindow = *options.DisableAutoWindow
+	}
+	disableSegmentReorder := c.config.DisableSegmentReorder
+	if options.DisableSegmentReorder != nil {
+		disableSegmentReorder = *options.DisableSegmentReorder
+	}
+	if enableHybridIndex {
 		cmd = append(cmd, "--enable_hybrid_index")
 	}
-	if c.config.DisableAutoWindow {
+	if disableAutoWindow {
 		cmd = append(cmd, "--disable_auto_window")
 	}
-	if c.config.DisableSegmentReorder {
+	if disableSegmentReorder {
 		cmd = append(cmd, "--disable_segment_reorder")
 	}
 
+	// 可选模型参数
+	cmd = appendStringFlag(cmd, "--recall_model", c.config.RecallModel, options.RecallModel)
+	cmd = appendStringFlag(cmd, "--chunk_model", c.config.ChunkModel, options.ChunkModel)
+	cmd = appendStringFlag(cmd, "--qa_model", c.config.QAModel, options.QAModel)
+	cmd = appendStringFlag(cmd, "--emb_model", c.config.EmbModel, options.EmbModel)
+	cmd = appendStringFlag(cmd, "--agentic_model", c.config.AgenticModel, options.AgenticModel)
+	cmd = appendStringFlag(cmd, "--context_prune_model", c.config.ContextPruneModel, options.ContextPruneModel)
+
+	// 其他参数
+	cmd = appendStringFlag(cmd, "--tokenizer_path", c.config.TokenizerPath, options.TokenizerPath)
+	cmd = appendStringFlag(cmd, "--required_exts", c.config.RequiredExts, options.RequiredExts)
+	cmd = appendStringFlag(cmd, "--ray_address", c.config.RayAddress, options.RayAddress)
+
 	return cmd
 }
 
+// formatFloatFlag formats a float flag value with the shortest representation
+// that round-trips, so 0.75 stays 0.75 instead of being rounded
+func formatFloatFlag(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// appendStringFlag appends flag with the query override, or the config value
+// when no override is set. Nothing is appended if both are empty.
+func appendStringFlag(cmd []string, flag string, configValue string, optionValue string) []string {
+	value := configValue
+	if optionValue != "" {
+		value = optionValue
+	}
+	if value == "" {
+		return cmd
+	}
+	return append(cmd, flag, value)
+}
+
 // GetVersion returns the auto-coder.rag version
 func (c *RAGClient) GetVersion() string {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)  // 60秒超时
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, c.config.CommandPath, "--version")
-	cmd.Env = c.buildEnv(nil)
-	output, err := cmd.Output()
-	if err != nil {
+	req := &ExecRequest{
+		Args: []string{c.config.CommandPath, "--version"},
+		Env:  c.buildEnv(nil),
+	}
+	var output bytes.Buffer
+	exitCode, err := runProcess(ctx, c.executor(), req, &output, io.Discard)
+	if err != nil || exitCode != 0 {
 		return "unknown"
 	}
 
-	return strings.TrimSpace(string(output))
+	return strings.TrimSpace(output.String())
 }
 
 // CheckAvailability checks if auto-coder.rag command is available
@@ -604,9 +712,12 @@ func (c *RAGClient) CheckAvailability() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)  // 60秒超时
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, c.config.CommandPath, "--help")
-	cmd.Env = c.buildEnv(nil)
-	if err := cmd.Run(); err != nil {
+	req := &ExecRequest{
+		Args: []string{c.config.CommandPath, "--help"},
+		Env:  c.buildEnv(nil),
+	}
+	exitCode, err := runProcess(ctx, c.executor(), req, io.Discard, io.Discard)
+	if err != nil || exitCode != 0 {
 		return false
 	}
 
@@ -633,97 +744,3 @@ func QueryWithBuffer(resultChan <-chan string, errorChan <-chan error) (string,
 		}
 	}
 }
-
-// CountTokens counts tokens in a file
-//
-// This is a standalone function that can be called without creating a client instance.
-// It calls `auto-coder.rag tools count --file <file_path> --output_format json` to count tokens.
-//
-// Example:
-//
-//	result, err := ragclient.CountTokens("/path/to/file.xlsx", nil)
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-//	fmt.Printf("Total tokens: %d\n", result.TotalTokens)
-//
-//	// With options
-//	result, err := ragclient.CountTokens("/path/to/file.xlsx", &ragclient.TokenCountOptions{
-//	    TokenizerPath: "/path/to/tokenizer.json",
-//	})
-func CountTokens(filePath string, options *TokenCountOptions) (*TokenCountResult, error) {
-	if options == nil {
-		options = &TokenCountOptions{Timeout: 60}
-	}
-	if options.Timeout == 0 {
-		options.Timeout = 60
-	}
-
-	commandPath := "auto-coder.rag"
-
-	// Build command - always use JSON output format
-	cmd := []string{commandPath, "tools", "count", "--file", filePath, "--output_format", "json"}
-
-	if options.TokenizerPath != "" {
-		cmd = append(cmd, "--tokenizer_path", options.TokenizerPath)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(options.Timeout)*time.Second)
-	defer cancel()
-
-	execCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
-
-	// Build environment
-	env := os.Environ()
-	if options.Envs != nil {
-		for k, v := range options.Envs {
-			env = append(env, k+"="+v)
-		}
-	}
-	execCmd.Env = env
-
-	// Execute command
-	output, err := execCmd.CombinedOutput()
-
-	if err != nil {
-		if execCmd.ProcessState != nil {
-			exitCode := execCmd.ProcessState.ExitCode()
-			return nil, &ExecutionError{
-				Message:  string(output),
-				ExitCode: exitCode,
-			}
-		}
-		return nil, &RAGError{Message: fmt.Sprintf("Error executing token count: %v", err)}
-	}
-
-	// Parse JSON output
-	return parseTokenCountJsonOutput(strings.TrimSpace(string(output)))
-}
-
-// parseTokenCountJsonOutput parses the JSON output from the token count command
-func parseTokenCountJsonOutput(output string) (*TokenCountResult, error) {
-	var result struct {
-		Files           []TokenCountFileResult `json:"files"`
-		TotalCharacters int                    `json:"totalCharacters"`
-		TotalTokens     int                    `json:"totalTokens"`
-	}
-
-	if err := json.Unmarshal([]byte(output), &result); err != nil {
-		return nil, &RAGError{Message: fmt.Sprintf("Failed to parse JSON output: %v. Output was: %s", err, output[:min(200, len(output))])}
-	}
-
-	return &TokenCountResult{
-		Files:           result.Files,
-		TotalCharacters: result.TotalCharacters,
-		TotalTokens:     result.TotalTokens,
-		RawOutput:       output,
-	}, nil
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
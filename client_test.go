@@ -0,0 +1,247 @@
+package ragclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPtr(v int) *int           { return &v }
+func floatPtr(v float64) *float64 { return &v }
+func boolPtr(v bool) *bool        { return &v }
+
+// ragArgs returns the RAG parameter flags, which are always passed
+func ragArgs(window, fullText, segment, relevance string) []string {
+	return []string{
+		"--rag_context_window_limit", window,
+		"--full_text_ratio", fullText,
+		"--segment_ratio", segment,
+		"--rag_doc_filter_relevance", relevance,
+	}
+}
+
+// argv joins the parts of an expected command line
+func argv(parts ...[]string) []string {
+	var cmd []string
+	for _, part := range parts {
+		cmd = append(cmd, part...)
+	}
+	return cmd
+}
+
+func TestBuildCommand(t *testing.T) {
+	head := []string{"auto-coder.rag", "run", "--doc_dir", "/docs", "--model", "v3_chat"}
+	text := []string{"--output_format", "text"}
+	lite := []string{"--lite"}
+	defaults := ragArgs("56000", "0.7", "0.2", "0")
+
+	tests := []struct {
+		name    string
+		config  func(c *RAGConfig)
+		options *RAGQueryOptions
+		want    []string
+	}{
+		{
+			name: "defaults",
+			want: argv(head, text, lite, defaults),
+		},
+		{
+			name:   "CommandPath and DocDir",
+			config: func(c *RAGConfig) { c.CommandPath = "/opt/bin/auto-coder.rag"; c.DocDir = "/other docs" },
+			want:   argv([]string{"/opt/bin/auto-coder.rag", "run", "--doc_dir", "/other docs", "--model", "v3_chat"}, text, lite, defaults),
+		},
+		{
+			name:   "Model from config",
+			config: func(c *RAGConfig) { c.Model = "deepseek_chat" },
+			want:   argv(head[:4], []string{"--model", "deepseek_chat"}, text, lite, defaults),
+		},
+		{
+			name:    "Model overridden by options",
+			config:  func(c *RAGConfig) { c.Model = "deepseek_chat" },
+			options: &RAGQueryOptions{Model: "qwen"},
+			want:    argv(head[:4], []string{"--model", "qwen"}, text, lite, defaults),
+		},
+		{
+			name:   "empty Model is omitted",
+			config: func(c *RAGConfig) { c.Model = "" },
+			want:   argv(head[:4], text, lite, defaults),
+		},
+		{
+			name:   "ModelFile from config",
+			config: func(c *RAGConfig) { c.ModelFile = "models.json" },
+			want:   argv(head, []string{"--model_file", "models.json"}, text, lite, defaults),
+		},
+		{
+			name:    "ModelFile overridden by options",
+			config:  func(c *RAGConfig) { c.ModelFile = "models.json" },
+			options: &RAGQueryOptions{ModelFile: "query.json"},
+			want:    argv(head, []string{"--model_file", "query.json"}, text, lite, defaults),
+		},
+		{
+			name:    "OutputFormat",
+			options: &RAGQueryOptions{OutputFormat: "stream-json"},
+			want:    argv(head, []string{"--output_format", "stream-json"}, lite, defaults),
+		},
+		{
+			name:   "Agentic from config",
+			config: func(c *RAGConfig) { c.Agentic = true },
+			want:   argv(head, text, []string{"--agentic"}, lite, defaults),
+		},
+		{
+			name:    "Agentic disabled by options",
+			config:  func(c *RAGConfig) { c.Agentic = true },
+			options: &RAGQueryOptions{Agentic: boolPtr(false)},
+			want:    argv(head, text, lite, defaults),
+		},
+		{
+			name:   "ProductMode from config",
+			config: func(c *RAGConfig) { c.ProductMode = "pro" },
+			want:   argv(head, text, []string{"--pro"}, defaults),
+		},
+		{
+			name:    "ProductMode overridden by options",
+			config:  func(c *RAGConfig) { c.ProductMode = "pro" },
+			options: &RAGQueryOptions{ProductMode: "lite"},
+			want:    argv(head, text, lite, defaults),
+		},
+		{
+			name: "RAG parameters from config",
+			config: func(c *RAGConfig) {
+				c.RagContextWindowLimit = 120000
+				c.FullTextRatio = 0.75
+				c.SegmentRatio = 0.15
+				c.RagDocFilterRelevance = 2.5
+			},
+			want: argv(head, text, lite, ragArgs("120000", "0.75", "0.15", "2.5")),
+		},
+		{
+			name:   "RAG parameters overridden by options",
+			config: func(c *RAGConfig) { c.RagContextWindowLimit = 120000 },
+			options: &RAGQueryOptions{
+				RagContextWindowLimit: intPtr(8000),
+				FullTextRatio:         floatPtr(0.5),
+				SegmentRatio:          floatPtr(0.3),
+				RagDocFilterRelevance: floatPtr(6),
+			},
+			want: argv(head, text, lite, ragArgs("8000", "0.5", "0.3", "6")),
+		},
+		{
+			name: "index flags from config",
+			config: func(c *RAGConfig) {
+				c.EnableHybridIndex = true
+				c.DisableAutoWindow = true
+				c.DisableSegmentReorder = true
+			},
+			want: argv(head, text, lite, defaults,
+				[]string{"--enable_hybrid_index", "--disable_auto_window", "--disable_segment_reorder"}),
+		},
+		{
+			name: "index flags overridden by options",
+			config: func(c *RAGConfig) {
+				c.EnableHybridIndex = true
+				c.DisableAutoWindow = true
+			},
+			options: &RAGQueryOptions{
+				EnableHybridIndex:     boolPtr(false),
+				DisableAutoWindow:     boolPtr(false),
+				DisableSegmentReorder: boolPtr(true),
+			},
+			want: argv(head, text, lite, defaults, []string{"--disable_segment_reorder"}),
+		},
+		{
+			name: "model fields from config",
+			config: func(c *RAGConfig) {
+				c.RecallModel = "recall"
+				c.ChunkModel = "chunk"
+				c.QAModel = "qa"
+				c.EmbModel = "emb"
+				c.AgenticModel = "agentic"
+				c.ContextPruneModel = "prune"
+			},
+			want: argv(head, text, lite, defaults, []string{
+				"--recall_model", "recall",
+				"--chunk_model", "chunk",
+				"--qa_model", "qa",
+				"--emb_model", "emb",
+				"--agentic_model", "agentic",
+				"--context_prune_model", "prune",
+			}),
+		},
+		{
+			name: "model fields overridden by options",
+			config: func(c *RAGConfig) {
+				c.RecallModel = "recall"
+				c.ChunkModel = "chunk"
+				c.QAModel = "qa"
+			},
+			options: &RAGQueryOptions{
+				RecallModel:       "recall2",
+				QAModel:           "qa2",
+				EmbModel:          "emb2",
+				AgenticModel:      "agentic2",
+				ContextPruneModel: "prune2",
+			},
+			want: argv(head, text, lite, defaults, []string{
+				"--recall_model", "recall2",
+				"--chunk_model", "chunk",
+				"--qa_model", "qa2",
+				"--emb_model", "emb2",
+				"--agentic_model", "agentic2",
+				"--context_prune_model", "prune2",
+			}),
+		},
+		{
+			name: "infrastructure fields from config",
+			config: func(c *RAGConfig) {
+				c.TokenizerPath = "/models/tokenizer.json"
+				c.RequiredExts = ".md,.txt"
+				c.RayAddress = "ray://head:10001"
+			},
+			want: argv(head, text, lite, defaults, []string{
+				"--tokenizer_path", "/models/tokenizer.json",
+				"--required_exts", ".md,.txt",
+				"--ray_address", "ray://head:10001",
+			}),
+		},
+		{
+			name: "infrastructure fields overridden by options",
+			config: func(c *RAGConfig) {
+				c.TokenizerPath = "/models/tokenizer.json"
+				c.RequiredExts = ".md,.txt"
+			},
+			options: &RAGQueryOptions{
+				TokenizerPath: "/other/tokenizer.json",
+				RequiredExts:  ".pdf",
+				RayAddress:    "local",
+			},
+			want: argv(head, text, lite, defaults, []string{
+				"--tokenizer_path", "/other/tokenizer.json",
+				"--required_exts", ".pdf",
+				"--ray_address", "local",
+			}),
+		},
+		{
+			name:   "RayAddress auto from config",
+			config: func(c *RAGConfig) { c.RayAddress = "auto" },
+			want:   argv(head, text, lite, defaults, []string{"--ray_address", "auto"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewRAGConfig("/docs")
+			if tt.config != nil {
+				tt.config(config)
+			}
+			options := tt.options
+			if options == nil {
+				options = &RAGQueryOptions{}
+			}
+			client := &RAGClient{config: config}
+
+			got := client.buildCommand(options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildCommand() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package ragclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Priority orders the queries waiting for a slot when MaxConcurrency is
+// reached: higher priorities start first, equal priorities in arrival order
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// ClientStats is a snapshot of the queries of a client
+type ClientStats struct {
+	// Queries whose auto-coder.rag process is running
+	InFlight int
+	// Queries waiting for a slot
+	Queued int
+	// Queries refused since the client was created because the queue was
+	// full or their queue wait timed out
+	Rejected uint64
+}
+
+// Stats returns the current number of running, queued and rejected queries
+//
+// Example:
+//
+//	config := ragclient.NewRAGConfig("./docs")
+//	config.MaxConcurrency = 4
+//	config.MaxQueueLength = 100
+//	client, _ := ragclient.NewRAGClientWithConfig(config)
+//	// ...
+//	stats := client.Stats()
+//	fmt.Printf("running=%d queued=%d rejected=%d\n", stats.InFlight, stats.Queued, stats.Rejected)
+func (c *RAGClient) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientStats{
+		InFlight: c.inFlight,
+		Queued:   len(c.queue),
+		Rejected: c.rejected,
+	}
+}
+
+// waiter is a query queued by acquire
+type waiter struct {
+	priority Priority
+	ready    chan struct{} // closed when a slot is handed over
+	granted  bool
+}
+
+// acquire registers a running query, failing once the client is closed.
+// When MaxConcurrency queries are already running it waits in the queue
+// until release hands over a slot, ctx is done or the queue wait times out.
+// Every successful acquire must be paired with a release.
+func (c *RAGClient) acquire(ctx context.Context, options *RAGQueryOptions) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return &RAGError{Message: "客户端已关闭", Err: ErrClientClosed}
+	}
+	if limit := c.config.MaxConcurrency; limit <= 0 || (c.inFlight < limit && len(c.queue) == 0) {
+		c.inFlight++
+		c.mu.Unlock()
+		return nil
+	}
+	if max := c.config.MaxQueueLength; max > 0 && len(c.queue) >= max {
+		c.rejected++
+		err := &RAGError{
+			Message: fmt.Sprintf("查询队列已满 (%d 个查询正在执行, %d 个查询排队)", c.inFlight, len(c.queue)),
+			Err:     ErrQueueFull,
+		}
+		c.mu.Unlock()
+		return err
+	}
+	w := &waiter{priority: options.Priority, ready: make(chan struct{})}
+	c.enqueue(w)
+	c.mu.Unlock()
+
+	queueTimeout := c.config.QueueTimeout
+	if options.QueueTimeout != nil {
+		queueTimeout = *options.QueueTimeout
+	}
+	var expired <-chan time.Time
+	if queueTimeout > 0 {
+		timer := time.NewTimer(time.Duration(queueTimeout) * time.Second)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		if c.leaveQueue(w, false) {
+			return nil
+		}
+		return newCanceledError(ctx)
+	case <-expired:
+		if c.leaveQueue(w, true) {
+			return nil
+		}
+		return &RAGError{
+			Message: fmt.Sprintf("排队等待超时 (%d秒)", queueTimeout),
+			Err:     ErrQueueTimeout,
+		}
+	}
+}
+
+// enqueue inserts w after the waiters of the same or a higher priority. It
+// must be called with mu held.
+func (c *RAGClient) enqueue(w *waiter) {
+	i := len(c.queue)
+	for i > 0 && c.queue[i-1].priority < w.priority {
+		i--
+	}
+	c.queue = append(c.queue, nil)
+	copy(c.queue[i+1:], c.queue[i:])
+	c.queue[i] = w
+}
+
+// leaveQueue removes a waiter that gave up, counting it as rejected when
+// requested. It returns true when a slot was handed over in the meantime,
+// in which case the waiter holds it and must release it.
+func (c *RAGClient) leaveQueue(w *waiter, rejected bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if w.granted {
+		return true
+	}
+	for i, queued := range c.queue {
+		if queued == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			break
+		}
+	}
+	if rejected {
+		c.rejected++
+	}
+	return false
+}
+
+// release marks a query registered by acquire as finished and hands its
+// slot to the next queued query
+func (c *RAGClient) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	for len(c.queue) > 0 && (c.config.MaxConcurrency <= 0 || c.inFlight < c.config.MaxConcurrency) {
+		w := c.queue[0]
+		c.queue[0] = nil
+		c.queue = c.queue[1:]
+		w.granted = true
+		c.inFlight++
+		close(w.ready)
+	}
+}
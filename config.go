@@ -0,0 +1,407 @@
+package ragclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadRAGConfig loads a configuration file on top of the NewRAGConfig
+// defaults
+//
+// Files ending in .yaml or .yml are parsed as YAML, other files as JSON.
+// Keys are the snake_case names of the json struct tags, e.g. "full_text_ratio";
+// unknown keys are rejected so that typos are not silently ignored. Keys
+// missing from the file keep their default value. Relative paths are used
+// as is, i.e. relative to the working directory of the process.
+//
+// Only a minimal YAML subset is supported: top-level "key: value" pairs with
+// plain, single- or double-quoted scalars, comments, lists written as
+// "[a, b]" or "a,b", and the "envs" mapping with one indented "NAME: value"
+// pair per line.
+//
+// Precedence, from low to high: NewRAGConfig defaults, the file, and
+// environment variables when ApplyEnv is called on the result.
+//
+// Example:
+//
+//	config, err := ragclient.LoadRAGConfig("rag.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	// RAG_MODEL=deepseek_chat overrides the model of the file
+//	if err := config.ApplyEnv("RAG"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	client, err := ragclient.NewRAGClientWithConfig(config)
+func LoadRAGConfig(path string) (*RAGConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &RAGError{Message: fmt.Sprintf("Failed to read config file: %v", err), Err: err}
+	}
+
+	config := NewRAGConfig("")
+	if isYAMLPath(path) {
+		err = parseYAMLConfig(data, config)
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	}
+	if err != nil {
+		return nil, &ValidationError{Message: fmt.Sprintf("Invalid config file %s: %v", path, err)}
+	}
+	return config, nil
+}
+
+// RAGConfigFromEnv builds a configuration from environment variables on top
+// of the NewRAGConfig defaults
+//
+// See ApplyEnv for the variable names.
+//
+// Example:
+//
+//	// RAG_DOC_DIR=./docs RAG_FULL_TEXT_RATIO=0.6 RAG_ENVS_OPENAI_API_KEY=sk-...
+//	config, err := ragclient.RAGConfigFromEnv("RAG")
+func RAGConfigFromEnv(prefix string) (*RAGConfig, error) {
+	config := NewRAGConfig("")
+	if err := config.ApplyEnv(prefix); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides the configuration with environment variables
+//
+// The variable of a field is the prefix followed by the upper-cased key,
+// e.g. RAG_FULL_TEXT_RATIO for prefix "RAG". Lists such as EnvAllowlist are
+// comma separated. Variables named <PREFIX>_ENVS_<NAME> are added to Envs as
+// NAME. Unset variables leave the field unchanged, set but empty ones reset
+// it to its zero value (e.g. an empty RAG_TIMEOUT sets Timeout to 0).
+func (c *RAGConfig) ApplyEnv(prefix string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	for _, field := range configFields() {
+		if field.key == "envs" {
+			continue
+		}
+		name := strings.ToUpper(prefix + field.key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := c.setField(field, value); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("Invalid environment variable %s: %v", name, err)}
+		}
+	}
+
+	envsPrefix := strings.ToUpper(prefix + "envs_")
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if name := strings.TrimPrefix(key, envsPrefix); name != key && name != "" {
+			if c.Envs == nil {
+				c.Envs = make(map[string]string)
+			}
+			c.Envs[name] = value
+		}
+	}
+	return nil
+}
+
+// Save writes the configuration to path, as YAML for .yaml and .yml files
+// and as JSON otherwise, so that LoadRAGConfig reads it back unchanged.
+// Executor, RetryPolicy and CircuitBreaker are not saved.
+//
+// The file is only readable by its owner (mode 0600), as Envs usually holds
+// API keys.
+func (c *RAGConfig) Save(path string) error {
+	var data []byte
+	if isYAMLPath(path) {
+		data = c.marshalYAML()
+	} else {
+		var err error
+		data, err = json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return &RAGError{Message: fmt.Sprintf("Failed to encode config: %v", err), Err: err}
+		}
+		data = append(data, '\n')
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return &RAGError{Message: fmt.Sprintf("Failed to write config file: %v", err), Err: err}
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return &RAGError{Message: fmt.Sprintf("Failed to write config file: %v", err), Err: err}
+	}
+	return nil
+}
+
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// configField is a RAGConfig field that can be loaded from a file or the
+// environment
+type configField struct {
+	key   string
+	index int
+}
+
+// configFields lists the tagged RAGConfig fields in declaration order
+func configFields() []configField {
+	var fields []configField
+	t := reflect.TypeOf(RAGConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, configField{key: key, index: i})
+	}
+	return fields
+}
+
+// lookupConfigField returns the field with the given key
+func lookupConfigField(key string) (configField, bool) {
+	for _, field := range configFields() {
+		if field.key == key {
+			return field, true
+		}
+	}
+	return configField{}, false
+}
+
+// setField parses value into a scalar or list field. An empty value resets
+// a field that is not a string to its zero value.
+func (c *RAGConfig) setField(field configField, value string) error {
+	v := reflect.ValueOf(c).Elem().Field(field.index)
+	if v.Kind() != reflect.String && strings.TrimSpace(value) == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %q", field.key, value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number: %q", field.key, value)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %q", field.key, value)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		// Comma separated list, optionally in YAML flow style: [a, "b"]
+		list := strings.TrimSpace(value)
+		if strings.HasPrefix(list, "[") && strings.HasSuffix(list, "]") {
+			list = list[1 : len(list)-1]
+		}
+		items := []string{}
+		for _, item := range splitYAMLList(list) {
+			item, isNull, err := parseYAMLScalar(strings.TrimSpace(item))
+			if err != nil {
+				return fmt.Errorf("%s: %v", field.key, err)
+			}
+			if !isNull {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s is not a scalar", field.key)
+	}
+	return nil
+}
+
+// parseYAMLConfig applies a YAML document in the subset documented on
+// LoadRAGConfig to config
+func parseYAMLConfig(data []byte, config *RAGConfig) error {
+	inEnvs := false
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line = strings.TrimRight(stripYAMLComment(strings.TrimRight(line, "\r")), " \t")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+
+		indented := line[0] == ' ' || line[0] == '\t'
+		rawKey, rawValue, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			return fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		key, _, err := parseYAMLScalar(strings.TrimSpace(rawKey))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		value, isNull, err := parseYAMLScalar(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+
+		if indented {
+			if !inEnvs {
+				return fmt.Errorf("line %d: unexpected indentation", lineNo)
+			}
+			if config.Envs == nil {
+				config.Envs = make(map[string]string)
+			}
+			config.Envs[key] = value
+			continue
+		}
+
+		inEnvs = false
+		field, ok := lookupConfigField(key)
+		if !ok {
+			return fmt.Errorf("line %d: unknown key %q", lineNo, key)
+		}
+		if field.key == "envs" {
+			switch strings.TrimSpace(rawValue) {
+			case "", "{}":
+				inEnvs = true
+			default:
+				return fmt.Errorf("line %d: envs must be a mapping", lineNo)
+			}
+			continue
+		}
+		if isNull {
+			continue
+		}
+		if err := config.setField(field, value); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	return nil
+}
+
+// stripYAMLComment removes a trailing # comment outside of quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitYAMLList splits a comma separated list at the commas outside of
+// quotes
+func splitYAMLList(list string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, list[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, list[start:])
+}
+
+// parseYAMLScalar unquotes a YAML scalar, reporting ~, null and empty
+// values as null
+func parseYAMLScalar(s string) (string, bool, error) {
+	switch {
+	case s == "" || s == "~" || s == "null":
+		return "", true, nil
+	case strings.HasPrefix(s, `"`):
+		// JSON strings are valid YAML double-quoted scalars
+		var value string
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return "", false, fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return value, false, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", false, fmt.Errorf("invalid single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), false, nil
+	}
+	return s, false, nil
+}
+
+// marshalYAML encodes the configuration in the YAML subset read by
+// parseYAMLConfig
+func (c *RAGConfig) marshalYAML() []byte {
+	var b bytes.Buffer
+	v := reflect.ValueOf(c).Elem()
+	for _, field := range configFields() {
+		value := v.Field(field.index)
+		switch value.Kind() {
+		case reflect.String:
+			fmt.Fprintf(&b, "%s: %s\n", field.key, quoteYAML(value.String()))
+		case reflect.Float64:
+			fmt.Fprintf(&b, "%s: %s\n", field.key, formatFloatFlag(value.Float()))
+		case reflect.Slice:
+			if value.Len() == 0 {
+				continue
+			}
+			items := make([]string, value.Len())
+			for i := range items {
+				items[i] = quoteYAML(value.Index(i).String())
+			}
+			fmt.Fprintf(&b, "%s: [%s]\n", field.key, strings.Join(items, ", "))
+		case reflect.Map:
+			if len(c.Envs) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "%s:\n", field.key)
+			names := make([]string, 0, len(c.Envs))
+			for name := range c.Envs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&b, "  %s: %s\n", quoteYAML(name), quoteYAML(c.Envs[name]))
+			}
+		default:
+			fmt.Fprintf(&b, "%s: %v\n", field.key, value.Interface())
+		}
+	}
+	return b.Bytes()
+}
+
+// quoteYAML double-quotes s using JSON escaping
+func quoteYAML(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
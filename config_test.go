@@ -0,0 +1,178 @@
+package ragclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	config := NewRAGConfig("./文档 目录")
+	config.Model = `model "with" quotes`
+	config.Timeout = 600
+	config.FullTextRatio = 0.55
+	config.SegmentRatio = 0.125
+	config.Agentic = true
+	config.ProductMode = "pro"
+	config.RequiredExts = ".md,.txt"
+	config.Envs = map[string]string{"OPENAI_API_KEY": "sk-#1: 'x'", "EMPTY": ""}
+	config.EnvMode = EnvModeAllowlist
+	config.EnvAllowlist = []string{"HOME", "LANG, C"}
+	config.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+
+	for _, name := range []string{"rag.yaml", "rag.yml", "rag.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := config.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadRAGConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := *config
+			want.RetryPolicy = nil
+			if !reflect.DeepEqual(loaded, &want) {
+				t.Errorf("LoadRAGConfig() = %+v, want %+v", loaded, &want)
+			}
+		})
+	}
+}
+
+func TestSaveFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "rag.yaml")
+	// 已存在的文件也应收紧权限
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := NewRAGConfig("./docs")
+	config.Envs = map[string]string{"OPENAI_API_KEY": "sk-xxx"}
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rag.yaml")
+	file := `# 配置文件
+doc_dir: ./docs
+model: file_model   # 被环境变量覆盖
+timeout: 600
+full_text_ratio: 0.6
+envs:
+  OPENAI_API_KEY: from_file
+  KEEP: kept
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RAG_MODEL", "env_model")
+	t.Setenv("RAG_SEGMENT_RATIO", "0.3")
+	t.Setenv("RAG_ENVS_OPENAI_API_KEY", "from_env")
+
+	config, err := LoadRAGConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ApplyEnv("RAG"); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := NewRAGConfig("")
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"ProductMode (default)", config.ProductMode, defaults.ProductMode},
+		{"RagContextWindowLimit (default)", config.RagContextWindowLimit, defaults.RagContextWindowLimit},
+		{"DocDir (file)", config.DocDir, "./docs"},
+		{"Timeout (file)", config.Timeout, 600},
+		{"FullTextRatio (file)", config.FullTextRatio, 0.6},
+		{"Model (env)", config.Model, "env_model"},
+		{"SegmentRatio (env)", config.SegmentRatio, 0.3},
+		{"Envs", config.Envs, map[string]string{"OPENAI_API_KEY": "from_env", "KEEP": "kept"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnvEmptyResetsField(t *testing.T) {
+	config := NewRAGConfig("./docs")
+	config.Timeout = 600
+	config.Agentic = true
+	config.FullTextRatio = 0.5
+	config.EnvAllowlist = []string{"HOME"}
+	for _, name := range []string{"RAG_TIMEOUT", "RAG_AGENTIC", "RAG_FULL_TEXT_RATIO", "RAG_ENV_ALLOWLIST", "RAG_MODEL"} {
+		t.Setenv(name, "")
+	}
+
+	if err := config.ApplyEnv("RAG"); err != nil {
+		t.Fatalf("ApplyEnv() error = %v", err)
+	}
+	if config.Timeout != 0 || config.Agentic || config.FullTextRatio != 0 || config.EnvAllowlist != nil || config.Model != "" {
+		t.Errorf("config = %+v, want the fields reset", config)
+	}
+}
+
+func TestApplyEnvInvalidValue(t *testing.T) {
+	t.Setenv("RAG_TIMEOUT", "ten")
+	err := NewRAGConfig("./docs").ApplyEnv("RAG")
+	if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "RAG_TIMEOUT") {
+		t.Errorf("ApplyEnv() error = %v, want a ValidationError naming RAG_TIMEOUT", err)
+	}
+}
+
+func TestLoadRAGConfigMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "unknown key", file: "rag.yaml", content: "doc_dir: ./docs\nmodle: x\n"},
+		{name: "missing colon", file: "rag.yaml", content: "doc_dir ./docs\n"},
+		{name: "unexpected indentation", file: "rag.yaml", content: "model: x\n  timeout: 1\n"},
+		{name: "envs is not a mapping", file: "rag.yaml", content: "envs: KEY=value\n"},
+		{name: "invalid integer", file: "rag.yaml", content: "timeout: 10s\n"},
+		{name: "invalid number", file: "rag.yaml", content: "full_text_ratio: high\n"},
+		{name: "invalid bool", file: "rag.yaml", content: "agentic: maybe\n"},
+		{name: "unterminated double quote", file: "rag.yaml", content: "model: \"deepseek\n"},
+		{name: "unterminated single quote", file: "rag.yaml", content: "model: 'deepseek\n"},
+		{name: "invalid list item", file: "rag.yaml", content: "env_allowlist: [HOME, \"LANG]\n"},
+		{name: "unknown JSON key", file: "rag.json", content: `{"modle": "x"}`},
+		{name: "invalid JSON", file: "rag.json", content: `{"model": }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadRAGConfig(path)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("LoadRAGConfig() = %+v, %v, want a ValidationError", config, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package ragclient
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// windowsReservedNames are device names that cannot be used as file names on
+// Windows, with or without an extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// reservedDocNames are names auto-coder.rag uses inside the document
+// directory for its own index and cache files
+var reservedDocNames = map[string]bool{
+	".cache": true,
+}
+
+// newRAGClientFromDocuments writes texts into tempDir (or a new temporary
+// directory named after pattern) and creates a client on it. Everything
+// written is removed again if any step fails.
+func newRAGClientFromDocuments(texts []TextDocument, tempDir string, pattern string) (*RAGClient, error) {
+	// Validate file names and decode contents before touching the disk
+	filenames, err := resolveDocumentNames(texts)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([][]byte, len(texts))
+	for i, doc := range texts {
+		content, err := decodeDocument(doc, filenames[i])
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(content)) == "" {
+			return nil, &ValidationError{Message: fmt.Sprintf("Document '%s' content cannot be empty", filenames[i])}
+		}
+		contents[i] = content
+	}
+
+	// Create directory
+	docPath, owned, err := prepareDocDir(tempDir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files and directories created in a tempDir the SDK does not own
+	var created []string
+	cleanup := func() {
+		if owned {
+			os.RemoveAll(docPath)
+			return
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			os.Remove(created[i])
+		}
+	}
+
+	// Write all files
+	for i, filename := range filenames {
+		paths, err := writeDocument(docPath, filename, contents[i])
+		created = append(created, paths...)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	// Create and return client
+	client, err := NewRAGClient(docPath)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if owned {
+		client.ownedDocDir = docPath
+	}
+	return client, nil
+}
+
+// prepareDocDir returns the directory to write documents into, and whether
+// the SDK created it. An existing tempDir is used as is.
+func prepareDocDir(tempDir string, pattern string) (string, bool, error) {
+	if tempDir == "" {
+		docPath, err := os.MkdirTemp("", pattern)
+		if err != nil {
+			return "", false, &RAGError{Message: fmt.Sprintf("Failed to create temp directory: %v", err), Err: err}
+		}
+		return docPath, true, nil
+	}
+
+	if _, err := os.Stat(tempDir); err == nil {
+		return tempDir, false, nil
+	}
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", false, &RAGError{Message: fmt.Sprintf("Failed to create directory: %v", err), Err: err}
+	}
+	return tempDir, true, nil
+}
+
+// resolveDocumentNames returns the cleaned, slash-separated relative path of
+// every document, generating names for documents without one. It rejects
+// unsafe, reserved and duplicate names.
+func resolveDocumentNames(texts []TextDocument) ([]string, error) {
+	filenames := make([]string, len(texts))
+	files := make(map[string]string)
+	dirs := make(map[string]string)
+
+	for i, doc := range texts {
+		filename := doc.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("doc_%d.md", i)
+		}
+
+		cleaned, err := cleanDocumentName(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		// Compare case-insensitively, as macOS and Windows file systems do
+		key := strings.ToLower(cleaned)
+		if other, ok := files[key]; ok {
+			return nil, &ValidationError{Message: fmt.Sprintf("Duplicate document filename '%s' (conflicts with '%s')", filename, other)}
+		}
+		if other, ok := dirs[key]; ok {
+			return nil, &ValidationError{Message: fmt.Sprintf("Document filename '%s' conflicts with directory of '%s'", filename, other)}
+		}
+		for dir := path.Dir(key); dir != "."; dir = path.Dir(dir) {
+			if other, ok := files[dir]; ok {
+				return nil, &ValidationError{Message: fmt.Sprintf("Document filename '%s' uses '%s' as a directory", filename, other)}
+			}
+			dirs[dir] = filename
+		}
+
+		files[key] = filename
+		filenames[i] = cleaned
+	}
+
+	return filenames, nil
+}
+
+// cleanDocumentName validates a document filename and returns it cleaned.
+// Nested names use "/" as separator on every platform.
+func cleanDocumentName(filename string) (string, error) {
+	invalid := func(reason string) error {
+		return &ValidationError{Message: fmt.Sprintf("Invalid document filename '%s': %s", filename, reason)}
+	}
+
+	if strings.Contains(filename, "\\") {
+		return "", invalid("use '/' to separate directories")
+	}
+	if strings.Contains(filename, ":") {
+		return "", invalid("':' is not allowed")
+	}
+	for _, r := range filename {
+		if r < 0x20 || r == 0x7f {
+			return "", invalid("contains control characters")
+		}
+	}
+	if path.IsAbs(filename) {
+		return "", invalid("absolute paths are not allowed")
+	}
+
+	for _, part := range strings.Split(filename, "/") {
+		if part == ".." {
+			return "", invalid("path traversal is not allowed")
+		}
+	}
+
+	cleaned := path.Clean(filename)
+	if cleaned == "." {
+		return "", invalid("empty file name")
+	}
+
+	for _, part := range strings.Split(cleaned, "/") {
+		base := strings.ToLower(part)
+		if dot := strings.IndexByte(base, '.'); dot > 0 {
+			base = base[:dot]
+		}
+		if windowsReservedNames[base] {
+			return "", invalid(fmt.Sprintf("'%s' is a reserved name", part))
+		}
+		if reservedDocNames[strings.ToLower(part)] {
+			return "", invalid(fmt.Sprintf("'%s' is reserved by auto-coder.rag", part))
+		}
+		if strings.HasSuffix(part, ".") || strings.HasSuffix(part, " ") {
+			return "", invalid("names must not end with '.' or ' '")
+		}
+	}
+
+	return cleaned, nil
+}
+
+// writeDocument writes content to the slash-separated relative filename under
+// docPath, creating parent directories as needed. Symlinks are never
+// followed, so a pre-existing tempDir cannot redirect writes outside of it.
+// It returns the directories and file it created, in creation order.
+func writeDocument(docPath string, filename string, content []byte) ([]string, error) {
+	var created []string
+	writeErr := func(err error) error {
+		return &RAGError{Message: fmt.Sprintf("Failed to write file %s: %v", filename, err), Err: err}
+	}
+
+	parts := strings.Split(filename, "/")
+	dir := docPath
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(dir, 0755); err != nil {
+				return created, writeErr(err)
+			}
+			created = append(created, dir)
+			continue
+		}
+		if err != nil {
+			return created, writeErr(err)
+		}
+		if !info.IsDir() {
+			return created, writeErr(fmt.Errorf("%s is not a directory", dir))
+		}
+	}
+
+	filePath := filepath.Join(dir, parts[len(parts)-1])
+	info, err := os.Lstat(filePath)
+	if err == nil && !info.Mode().IsRegular() {
+		return created, writeErr(fmt.Errorf("%s exists and is not a regular file", filePath))
+	}
+	existed := err == nil
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return created, writeErr(err)
+	}
+	// An overwritten file is not reported, cleanup must not delete it
+	if !existed {
+		created = append(created, filePath)
+	}
+	return created, nil
+}
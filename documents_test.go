@@ -0,0 +1,175 @@
+package ragclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanDocumentName(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string // empty when the name is rejected
+	}{
+		{name: "plain", filename: "a.md", want: "a.md"},
+		{name: "nested", filename: "dir/sub/a.md", want: "dir/sub/a.md"},
+		{name: "redundant separators", filename: "./dir//a.md", want: "dir/a.md"},
+		{name: "traversal", filename: "../a.md"},
+		{name: "nested traversal", filename: "dir/../../a.md"},
+		{name: "traversal inside", filename: "dir/../a.md"},
+		{name: "absolute", filename: "/etc/passwd"},
+		{name: "drive letter", filename: "C:/a.md"},
+		{name: "drive letter with backslash", filename: `C:\a.md`},
+		{name: "backslash", filename: `dir\a.md`},
+		{name: "empty", filename: ""},
+		{name: "dot", filename: "."},
+		{name: "dot slash", filename: "./"},
+		{name: "control character", filename: "a\x00.md"},
+		{name: "reserved device", filename: "CON"},
+		{name: "reserved device with extension", filename: "con.txt"},
+		{name: "nested reserved device", filename: "dir/LPT1.md"},
+		{name: "reserved by auto-coder.rag", filename: ".cache/a.md"},
+		{name: "reserved by auto-coder.rag in upper case", filename: ".CACHE"},
+		{name: "trailing dot", filename: "a.md."},
+		{name: "trailing space", filename: "dir /a.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanDocumentName(tt.filename)
+			if tt.want == "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("cleanDocumentName(%q) = %q, %v, want a ValidationError", tt.filename, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("cleanDocumentName(%q) = %q, %v, want %q", tt.filename, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDocumentNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		filenames []string
+		want      []string // nil when the names are rejected
+	}{
+		{name: "generated", filenames: []string{"", "b.md", ""}, want: []string{"doc_0.md", "b.md", "doc_2.md"}},
+		{name: "nested", filenames: []string{"a/b.md", "a/c.md", "a/d/e.md"}, want: []string{"a/b.md", "a/c.md", "a/d/e.md"}},
+		{name: "duplicate", filenames: []string{"a.md", "./a.md"}},
+		{name: "duplicate in another case", filenames: []string{"A.md", "a.md"}},
+		{name: "duplicate of a generated name", filenames: []string{"", "doc_0.md"}},
+		{name: "nested duplicate in another case", filenames: []string{"Dir/a.md", "dir/A.md"}},
+		{name: "file used as directory", filenames: []string{"a", "a/b.md"}},
+		{name: "directory used as file", filenames: []string{"a/b.md", "A"}},
+		{name: "unsafe name", filenames: []string{"a.md", "../b.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			texts := make([]TextDocument, len(tt.filenames))
+			for i, filename := range tt.filenames {
+				texts[i] = TextDocument{Content: "内容", Filename: filename}
+			}
+
+			got, err := resolveDocumentNames(texts)
+			if tt.want == nil {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("resolveDocumentNames() = %q, %v, want a ValidationError", got, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveDocumentNames() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDocumentRefusesSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	target := filepath.Join(outside, "target.md")
+	if err := os.WriteFile(target, []byte("原内容"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		link     string // symlink planted in the document directory
+		to       string
+		filename string
+	}{
+		{name: "file", link: "a.md", to: target, filename: "a.md"},
+		{name: "directory", link: "dir", to: outside, filename: "dir/target.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docPath := t.TempDir()
+			if err := os.Symlink(tt.to, filepath.Join(docPath, tt.link)); err != nil {
+				t.Skipf("symlinks are not supported: %v", err)
+			}
+
+			created, err := writeDocument(docPath, tt.filename, []byte("新内容"))
+			if err == nil {
+				t.Fatal("writeDocument() followed a symlink")
+			}
+			if len(created) != 0 {
+				t.Errorf("created = %q, want nothing", created)
+			}
+			if content, _ := os.ReadFile(target); string(content) != "原内容" {
+				t.Errorf("target content = %q, want it unchanged", content)
+			}
+		})
+	}
+}
+
+func TestNewRAGClientFromTextsCleansUpAfterWriteFailure(t *testing.T) {
+	// 文件名过长, 在写入第三个文档时失败
+	texts := []TextDocument{
+		{Content: "内容", Filename: "a.md"},
+		{Content: "内容", Filename: "sub/b.md"},
+		{Content: "内容", Filename: strings.Repeat("x", 300) + ".md"},
+	}
+
+	t.Run("owned directory", func(t *testing.T) {
+		tempDir := filepath.Join(t.TempDir(), "docs")
+		if _, err := NewRAGClientFromTexts(texts, tempDir); err == nil {
+			t.Fatal("NewRAGClientFromTexts() succeeded")
+		}
+		if _, err := os.Lstat(tempDir); !os.IsNotExist(err) {
+			t.Errorf("directory created by the SDK was not removed: %v", err)
+		}
+	})
+
+	t.Run("existing directory", func(t *testing.T) {
+		tempDir := t.TempDir()
+		existing := filepath.Join(tempDir, "keep.md")
+		if err := os.WriteFile(existing, []byte("用户文件"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewRAGClientFromTexts(texts, tempDir); err == nil {
+			t.Fatal("NewRAGClientFromTexts() succeeded")
+		}
+
+		entries, err := os.ReadDir(tempDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "keep.md" {
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			t.Errorf("directory contains %q, want only keep.md", names)
+		}
+	})
+}
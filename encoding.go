@@ -0,0 +1,95 @@
+package ragclient
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeDocument converts the raw bytes of doc.Content from doc.Encoding into
+// UTF-8. Supported encodings are utf-8 (default), utf-16, utf-16le, utf-16be
+// and iso-8859-1 (latin1). "utf-16" detects the byte order from the BOM and
+// falls back to little-endian without one, like Python does.
+func decodeDocument(doc TextDocument, filename string) ([]byte, error) {
+	content := []byte(doc.Content)
+	invalid := func(format string, args ...interface{}) error {
+		return &ValidationError{Message: fmt.Sprintf("Document '%s': %s", filename, fmt.Sprintf(format, args...))}
+	}
+
+	encoding := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(doc.Encoding)), "_", "-")
+	switch encoding {
+	case "", "utf-8", "utf8":
+		content = bytes.TrimPrefix(content, bomUTF8)
+		if !utf8.Valid(content) {
+			return nil, invalid("content is not valid UTF-8")
+		}
+		return content, nil
+
+	case "utf-16", "utf16":
+		if bytes.HasPrefix(content, bomUTF16BE) {
+			return decodeUTF16(content[2:], true, invalid)
+		}
+		return decodeUTF16(bytes.TrimPrefix(content, bomUTF16LE), false, invalid)
+
+	case "utf-16le", "utf16le":
+		return decodeUTF16(bytes.TrimPrefix(content, bomUTF16LE), false, invalid)
+
+	case "utf-16be", "utf16be":
+		return decodeUTF16(bytes.TrimPrefix(content, bomUTF16BE), true, invalid)
+
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		// Every byte maps to the code point of the same value
+		var buf bytes.Buffer
+		buf.Grow(len(content))
+		for _, b := range content {
+			buf.WriteRune(rune(b))
+		}
+		return buf.Bytes(), nil
+	}
+
+	return nil, invalid("unsupported encoding '%s' (supported: utf-8, utf-16, utf-16le, utf-16be, iso-8859-1)", doc.Encoding)
+}
+
+// decodeUTF16 decodes BOM-less UTF-16 in the given byte order, rejecting odd
+// lengths and unpaired surrogates
+func decodeUTF16(content []byte, bigEndian bool, invalid func(format string, args ...interface{}) error) ([]byte, error) {
+	if len(content)%2 != 0 {
+		return nil, invalid("UTF-16 content has an odd number of bytes")
+	}
+
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(units))
+	for i := 0; i < len(units); i++ {
+		unit := units[i]
+		switch {
+		case unit >= 0xD800 && unit < 0xDC00:
+			if i+1 >= len(units) || units[i+1] < 0xDC00 || units[i+1] >= 0xE000 {
+				return nil, invalid("invalid UTF-16 surrogate pair at byte %d", 2*i)
+			}
+			buf.WriteRune(utf16.DecodeRune(rune(unit), rune(units[i+1])))
+			i++
+		case unit >= 0xDC00 && unit < 0xE000:
+			return nil, invalid("invalid UTF-16 surrogate pair at byte %d", 2*i)
+		default:
+			buf.WriteRune(rune(unit))
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package ragclient
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, without a BOM
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestDecodeDocument(t *testing.T) {
+	// 包含需要代理对的字符
+	const text = "中文 text 😀"
+	le := encodeUTF16(text, false)
+	be := encodeUTF16(text, true)
+
+	tests := []struct {
+		name     string
+		encoding string
+		content  []byte
+		want     string // empty when the content is rejected
+	}{
+		{name: "default", content: []byte(text), want: text},
+		{name: "utf-8 with BOM", encoding: "UTF-8", content: concat(bomUTF8, []byte(text)), want: text},
+		{name: "utf8 alias", encoding: "utf8", content: []byte(text), want: text},
+		{name: "invalid utf-8 by default", content: []byte{'a', 0xff, 'b'}},
+		{name: "invalid utf-8", encoding: "utf-8", content: []byte{0xc3, 0x28}},
+		{name: "utf-16 with LE BOM", encoding: "utf-16", content: concat(bomUTF16LE, le), want: text},
+		{name: "utf-16 with BE BOM", encoding: "utf-16", content: concat(bomUTF16BE, be), want: text},
+		{name: "utf-16 without BOM is little-endian", encoding: "utf-16", content: le, want: text},
+		{name: "utf-16le", encoding: "utf-16le", content: le, want: text},
+		{name: "utf-16le with BOM", encoding: "UTF_16LE", content: concat(bomUTF16LE, le), want: text},
+		{name: "utf-16be", encoding: "utf-16be", content: be, want: text},
+		{name: "utf-16be with BOM", encoding: "utf16be", content: concat(bomUTF16BE, be), want: text},
+		{name: "utf-16 odd length", encoding: "utf-16le", content: le[:len(le)-1]},
+		{name: "utf-16 unpaired high surrogate", encoding: "utf-16le", content: []byte{0x3d, 0xd8, 'a', 0}},
+		{name: "utf-16 high surrogate at the end", encoding: "utf-16be", content: []byte{0, 'a', 0xd8, 0x3d}},
+		{name: "utf-16 unpaired low surrogate", encoding: "utf-16le", content: []byte{'a', 0, 0x00, 0xde}},
+		{name: "iso-8859-1", encoding: "iso-8859-1", content: []byte{'c', 'a', 'f', 0xe9, 0xff}, want: "caféÿ"},
+		{name: "latin1 alias", encoding: "Latin-1", content: []byte{0xa9}, want: "©"},
+		{name: "unknown encoding", encoding: "gbk", content: []byte(text)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := TextDocument{Content: string(tt.content), Encoding: tt.encoding}
+			got, err := decodeDocument(doc, "doc.md")
+			if tt.want == "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("decodeDocument() = %q, %v, want a ValidationError", got, err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("decodeDocument() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
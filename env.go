@@ -0,0 +1,136 @@
+package ragclient
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// EnvMode selects the environment the auto-coder.rag process starts from,
+// before Envs are layered on top
+type EnvMode string
+
+const (
+	// EnvModeInherit passes the whole environment of the Go process (default)
+	EnvModeInherit EnvMode = "inherit"
+	// EnvModeAllowlist passes only PATH, HOME, LANG and the names in EnvAllowlist
+	EnvModeAllowlist EnvMode = "allowlist"
+	// EnvModeEmpty passes only PATH (and SYSTEMROOT on Windows), which is
+	// needed to find auto-coder.rag and the interpreter of its
+	// "#!/usr/bin/env python3" script. Set Envs["PATH"] to override it.
+	EnvModeEmpty EnvMode = "empty"
+)
+
+// essentialEnv is inherited in every mode, the command cannot start
+// without it
+var essentialEnv = func() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"PATH", "SYSTEMROOT"}
+	}
+	return []string{"PATH"}
+}()
+
+// defaultEnvAllowlist is inherited in EnvModeAllowlist mode besides
+// essentialEnv. Python needs SYSTEMROOT to start on Windows.
+var defaultEnvAllowlist = append([]string{"HOME", "LANG"}, essentialEnv...)
+
+// Environ returns the environment a query with options would run with, in
+// sorted "KEY=VALUE" form and without redaction
+//
+// Useful in tests to check that no unexpected variable reaches the process.
+//
+// Example:
+//
+//	config := ragclient.NewRAGConfig("./docs")
+//	config.EnvMode = ragclient.EnvModeAllowlist
+//	config.EnvAllowlist = []string{"OPENAI_API_KEY"}
+//	client, _ := ragclient.NewRAGClientWithConfig(config)
+//	for _, env := range client.Environ(nil) {
+//	    fmt.Println(env)
+//	}
+func (c *RAGClient) Environ(options *RAGQueryOptions) []string {
+	return c.buildEnv(options)
+}
+
+// validEnvMode reports whether mode is a known EnvMode, "" meaning EnvModeInherit
+func validEnvMode(mode EnvMode) bool {
+	switch mode {
+	case "", EnvModeInherit, EnvModeAllowlist, EnvModeEmpty:
+		return true
+	}
+	return false
+}
+
+// baseEnv returns the system environment filtered according to mode
+func baseEnv(mode EnvMode, allowlist []string) []string {
+	switch mode {
+	case EnvModeEmpty:
+		return filterEnv(essentialEnv)
+	case EnvModeAllowlist:
+		return filterEnv(append(append([]string{}, defaultEnvAllowlist...), allowlist...))
+	}
+	return os.Environ()
+}
+
+// filterEnv returns the variables of the system environment named in names
+func filterEnv(names []string) []string {
+	allowed := make(map[string]bool)
+	for _, name := range names {
+		allowed[envKey(name)] = true
+	}
+	var env []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if allowed[envKey(key)] {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// envKey normalizes a variable name for comparison, names are case
+// insensitive on Windows
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// mergeEnv layers envs on top of base, later maps taking priority, following
+// the rules documented on buildEnv. The result is sorted and never nil, so
+// that an empty environment is not mistaken for an inherited one.
+func mergeEnv(base []string, windowsUtf8Env bool, envs ...map[string]string) []string {
+	envMap := make(map[string]string)
+
+	// 1. Parse base environment
+	for _, e := range base {
+		if key, value, ok := strings.Cut(e, "="); ok {
+			envMap[key] = value
+		}
+	}
+
+	// 2. Windows UTF-8 auto-config
+	if windowsUtf8Env && runtime.GOOS == "windows" {
+		envMap["PYTHONIOENCODING"] = "utf-8"
+		envMap["LANG"] = "zh_CN.UTF-8"
+		envMap["LC_ALL"] = "zh_CN.UTF-8"
+		envMap["CHCP"] = "65001"
+	}
+
+	// 3. Configured layers, in increasing priority
+	for _, layer := range envs {
+		for k, v := range layer {
+			envMap[k] = v
+		}
+	}
+
+	// Convert back to []string
+	result := make([]string, 0, len(envMap))
+	for k, v := range envMap {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,109 @@
+package ragclient
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("PATH", "/opt/python/bin:/usr/bin")
+	t.Setenv("HOME", "/home/rag")
+	t.Setenv("LANG", "C.UTF-8")
+	t.Setenv("RAG_TEST_SECRET", "secret")
+	t.Setenv("RAG_TEST_ALLOWED", "allowed")
+
+	// 只比较测试关心的变量, 继承模式下还有其他系统变量
+	essential := map[string]string{"PATH": "/opt/python/bin:/usr/bin"}
+	for _, name := range essentialEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			essential[name] = value
+		}
+	}
+	with := func(base map[string]string, extra map[string]string) map[string]string {
+		merged := make(map[string]string)
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	tests := []struct {
+		name      string
+		mode      EnvMode
+		allowlist []string
+		envs      map[string]string
+		options   *RAGQueryOptions
+		want      map[string]string
+		exact     bool // whether want is the whole environment
+	}{
+		{
+			name: "inherit",
+			want: with(essential, map[string]string{"HOME": "/home/rag", "RAG_TEST_SECRET": "secret", "RAG_TEST_ALLOWED": "allowed"}),
+		},
+		{
+			name:    "inherit with overrides",
+			mode:    EnvModeInherit,
+			envs:    map[string]string{"RAG_TEST_SECRET": "from_config", "MODEL_KEY": "config"},
+			options: &RAGQueryOptions{Envs: map[string]string{"MODEL_KEY": "query"}},
+			want:    with(essential, map[string]string{"RAG_TEST_SECRET": "from_config", "MODEL_KEY": "query"}),
+		},
+		{
+			name:      "allowlist",
+			mode:      EnvModeAllowlist,
+			allowlist: []string{"RAG_TEST_ALLOWED"},
+			envs:      map[string]string{"MODEL_KEY": "config"},
+			want:      with(essential, map[string]string{"HOME": "/home/rag", "LANG": "C.UTF-8", "RAG_TEST_ALLOWED": "allowed", "MODEL_KEY": "config"}),
+			exact:     true,
+		},
+		{
+			name:  "empty keeps PATH",
+			mode:  EnvModeEmpty,
+			envs:  map[string]string{"MODEL_KEY": "config"},
+			want:  with(essential, map[string]string{"MODEL_KEY": "config"}),
+			exact: true,
+		},
+		{
+			name:  "empty with PATH override",
+			mode:  EnvModeEmpty,
+			envs:  map[string]string{"PATH": "/srv/venv/bin"},
+			want:  with(essential, map[string]string{"PATH": "/srv/venv/bin"}),
+			exact: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewRAGConfig(t.TempDir())
+			config.EnvMode = tt.mode
+			config.EnvAllowlist = tt.allowlist
+			config.Envs = tt.envs
+			client, err := NewRAGClientWithConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			environ := client.Environ(tt.options)
+			got := make(map[string]string)
+			for _, entry := range environ {
+				key, value, _ := strings.Cut(entry, "=")
+				got[key] = value
+			}
+			if tt.exact {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Environ() = %q, want %v", environ, tt.want)
+				}
+				return
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Sentinel errors, use errors.Is to check which kind of failure occurred
+//
+//	answer, err := client.Query("问题", nil)
+//	switch {
+//	case errors.Is(err, ragclient.ErrTimeout):
+//	    // 超时
+//	case errors.Is(err, ragclient.ErrAuth):
+//	    // 模型认证失败
+//	}
+var (
+	ErrValidation      = errors.New("参数验证失败")
+	ErrExecution       = errors.New("执行失败")
+	ErrTimeout         = errors.New("执行超时")
+	ErrCanceled        = errors.New("查询已取消")
+	ErrCommandNotFound = errors.New("命令不存在")
+	ErrBadOutput       = errors.New("无法解析命令输出")
+	ErrModel           = errors.New("模型调用失败")
+	ErrAuth            = errors.New("模型认证失败")
+	ErrClientClosed    = errors.New("客户端已关闭")
+	ErrClientBusy      = errors.New("客户端仍有查询正在执行")
+
+	// 流式查询的首条输出超时和空闲超时, 同时也匹配 ErrTimeout
+	ErrFirstByteTimeout = errors.New("等待首条输出超时")
+	ErrIdleTimeout      = errors.New("输出空闲超时")
+
+	// 达到 MaxConcurrency 后排队失败
+	ErrQueueFull    = errors.New("查询队列已满")
+	ErrQueueTimeout = errors.New("排队等待超时")
+
+	ErrCircuitOpen = errors.New("熔断器已打开")
+)
+
+// RAGError represents a general SDK error
+type RAGError struct {
+	Message string
+	Err     error // Underlying error (may be nil)
+}
+
+func (e *RAGError) Error() string {
+	return e.Message
+}
+
+func (e *RAGError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError represents parameter validation errors
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ConfigError lists every problem found in a RAGConfig
+//
+// It matches ErrValidation, and errors.As finds the individual
+// ValidationError values.
+type ConfigError struct {
+	Errors []*ValidationError
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Message
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "配置无效, 共 %d 个问题:", len(e.Errors))
+	for _, err := range e.Errors {
+		b.WriteString("\n- ")
+		b.WriteString(err.Message)
+	}
+	return b.String()
+}
+
+func (e *ConfigError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Is reports whether target is ErrValidation
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ExecutionError represents execution errors
+type ExecutionError struct {
+	Message  string
+	ExitCode int
+
+	// Captured standard output and standard error of the command
+	Stdout string
+	Stderr string
+	// Command line that was executed
+	Command []string
+	// How long the command ran before failing
+	Duration time.Duration
+	// True when the command was killed because the query timeout expired
+	TimedOut bool
+	// Which limit expired when TimedOut is set
+	TimeoutKind TimeoutKind
+}
+
+// TimeoutKind tells which time limit a timed out command exceeded
+type TimeoutKind string
+
+const (
+	// TimeoutTotal is the overall query timeout (Timeout)
+	TimeoutTotal TimeoutKind = "total"
+	// TimeoutFirstByte is the time to the first output line of a stream
+	TimeoutFirstByte TimeoutKind = "first_byte"
+	// TimeoutIdle is the maximum silence between output lines of a stream
+	TimeoutIdle TimeoutKind = "idle"
+)
+
+func (e *ExecutionError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is ErrExecution, ErrTimeout for timed out
+// commands, ErrFirstByteTimeout / ErrIdleTimeout for the matching stream
+// limit, or ErrModel / ErrAuth when Stderr shows a model failure
+func (e *ExecutionError) Is(target error) bool {
+	switch target {
+	case ErrExecution:
+		return true
+	case ErrTimeout:
+		return e.TimedOut
+	case ErrFirstByteTimeout:
+		return e.TimedOut && e.TimeoutKind == TimeoutFirstByte
+	case ErrIdleTimeout:
+		return e.TimedOut && e.TimeoutKind == TimeoutIdle
+	case ErrModel, ErrAuth:
+		return classifyStderr(e.Stderr) == target
+	}
+	return false
+}
+
+// CanceledError is returned when a query's context is cancelled or its
+// deadline expires before the auto-coder.rag process finishes
+//
+// It matches ErrCanceled, and unwraps to context.Canceled or
+// context.DeadlineExceeded. Timeouts configured on the SDK itself are
+// reported as ExecutionError matching ErrTimeout instead.
+type CanceledError struct {
+	Message string
+	Err     error // context.Canceled or context.DeadlineExceeded
+}
+
+func (e *CanceledError) Error() string {
+	return e.Message
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrCanceled
+func (e *CanceledError) Is(target error) bool {
+	return target == ErrCanceled
+}
+
+func newCanceledError(ctx context.Context) *CanceledError {
+	return &CanceledError{
+		Message: fmt.Sprintf("查询已取消: %v", ctx.Err()),
+		Err:     ctx.Err(),
+	}
+}
+
+// CircuitOpenError is returned without running the query while the circuit
+// breaker is open, or half-open with all trial queries in progress
+type CircuitOpenError struct {
+	Message string
+	// Time left before the circuit becomes half-open, 0 when it already is
+	RetryAfter time.Duration
+	// Failure that opened the circuit
+	LastErr error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// RetryError is returned when a query retried according to its RetryPolicy
+// still failed. It wraps the error of the last attempt, so errors.Is and
+// errors.As see through it.
+//
+// Example:
+//
+//	answer, err := client.Query("如何使用这个项目?", nil)
+//	var retryErr *ragclient.RetryError
+//	if errors.As(err, &retryErr) {
+//	    for i, attempt := range retryErr.Attempts {
+//	        log.Printf("第 %d 次尝试 (%v): %v", i+1, attempt.Duration, attempt.Err)
+//	    }
+//	}
+type RetryError struct {
+	// Every attempt in order, the last one failed with Err
+	Attempts []AttemptInfo
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("查询在 %d 次尝试后失败: %v", len(e.Attempts), e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// CommandNotFoundError is returned when the auto-coder.rag command cannot be
+// found on PATH or at the configured CommandPath
+type CommandNotFoundError struct {
+	Message string
+	Command string
+	Err     error
+}
+
+func (e *CommandNotFoundError) Error() string {
+	return e.Message
+}
+
+func (e *CommandNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrCommandNotFound
+func (e *CommandNotFoundError) Is(target error) bool {
+	return target == ErrCommandNotFound
+}
+
+// TokenCountDirError is returned by CountTokensDir when some files could not
+// be counted. The result returned with it holds the other files.
+//
+// errors.Is and errors.As see the error of every file.
+type TokenCountDirError struct {
+	Files []*TokenCountFileError
+}
+
+func (e *TokenCountDirError) Error() string {
+	if len(e.Files) == 1 {
+		return e.Files[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Failed to count tokens of %d files:", len(e.Files))
+	for _, err := range e.Files {
+		b.WriteString("\n- ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e *TokenCountDirError) Unwrap() []error {
+	errs := make([]error, len(e.Files))
+	for i, err := range e.Files {
+		errs[i] = err
+	}
+	return errs
+}
+
+// TokenCountFileError is the error of a single file in a TokenCountDirError
+type TokenCountFileError struct {
+	File string
+	Err  error
+}
+
+func (e *TokenCountFileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *TokenCountFileError) Unwrap() error {
+	return e.Err
+}
+
+// OutputError is returned when the command succeeded but its output could
+// not be parsed
+type OutputError struct {
+	Message string
+	Output  string
+	Err     error
+}
+
+func (e *OutputError) Error() string {
+	return e.Message
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrBadOutput
+func (e *OutputError) Is(target error) bool {
+	return target == ErrBadOutput
+}
+
+// newStartError wraps an error returned while starting or waiting for a
+// command, reporting a missing executable as CommandNotFoundError
+func newStartError(message string, command string, err error) error {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return &CommandNotFoundError{
+			Message: fmt.Sprintf("命令不存在: %s (%v)", command, err),
+			Command: command,
+			Err:     err,
+		}
+	}
+	return &RAGError{Message: message, Err: err}
+}
+
+// Stderr patterns emitted by auto-coder.rag and the model SDKs it uses,
+// matched case-insensitively
+var (
+	authErrorPatterns = []string{
+		"authenticationerror",
+		"permissiondeniederror",
+		"invalid api key",
+		"invalid_api_key",
+		"incorrect api key",
+		"unauthorized",
+		"error code: 401",
+		"error code: 403",
+	}
+	modelErrorPatterns = []string{
+		"model_not_found",
+		"model not found",
+		"apierror",
+		"apiconnectionerror",
+		"apitimeouterror",
+		"ratelimiterror",
+		"badrequesterror",
+		"internalservererror",
+		"context_length_exceeded",
+	}
+)
+
+// classifyStderr infers ErrAuth or ErrModel from a command's stderr,
+// returning nil when no known pattern matches
+func classifyStderr(stderr string) error {
+	if stderr == "" {
+		return nil
+	}
+	lower := strings.ToLower(stderr)
+	for _, pattern := range authErrorPatterns {
+		if strings.Contains(lower, pattern) {
+			return ErrAuth
+		}
+	}
+	for _, pattern := range modelErrorPatterns {
+		if strings.Contains(lower, pattern) {
+			return ErrModel
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package ragclient
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a typed stream-json event, returned by Message.Decode
+//
+// The concrete type is one of *StartEvent, *StageEvent, *ContentEvent,
+// *ContextsEvent, *EndEvent or *UnknownEvent.
+//
+// Example:
+//
+//	event, err := msg.Decode()
+//	if err != nil {
+//	    return err
+//	}
+//	switch e := event.(type) {
+//	case *ragclient.ContentEvent:
+//	    fmt.Print(e.Content)
+//	case *ragclient.EndEvent:
+//	    fmt.Println("\ntokens:", e.Tokens)
+//	}
+type Event interface {
+	EventType() MessageType
+}
+
+// StartEvent is sent once when the query starts
+type StartEvent struct {
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+	Tokens  *TokenInfo `json:"tokens"`
+}
+
+func (e *StartEvent) EventType() MessageType {
+	return MessageTypeStart
+}
+
+// StageEvent reports progress of a processing stage
+type StageEvent struct {
+	Stage   StageType  `json:"type"`
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+	Tokens  *TokenInfo `json:"tokens"`
+}
+
+func (e *StageEvent) EventType() MessageType {
+	return MessageTypeStage
+}
+
+// ContentEvent carries a chunk of the generated answer
+type ContentEvent struct {
+	Content string     `json:"content"`
+	Tokens  *TokenInfo `json:"tokens"`
+}
+
+func (e *ContentEvent) EventType() MessageType {
+	return MessageTypeContent
+}
+
+// ContextsEvent carries the documents used to answer the question
+type ContextsEvent struct {
+	Contexts []string   `json:"contexts"`
+	Tokens   *TokenInfo `json:"tokens"`
+}
+
+func (e *ContextsEvent) EventType() MessageType {
+	return MessageTypeContexts
+}
+
+// EndEvent is sent once when the query finishes
+type EndEvent struct {
+	Status   string                 `json:"status"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Tokens   *TokenInfo             `json:"tokens"`
+}
+
+func (e *EndEvent) EventType() MessageType {
+	return MessageTypeEnd
+}
+
+// UnknownEvent keeps events of types this SDK version does not know about,
+// so newer auto-coder.rag versions keep working
+type UnknownEvent struct {
+	Type MessageType
+	Data map[string]interface{}
+}
+
+func (e *UnknownEvent) EventType() MessageType {
+	return e.Type
+}
+
+// Decode decodes the message data into its typed event
+//
+// Unlike the Get* helpers, a field with the wrong JSON type or a missing
+// required field (content, contexts, stage type) is reported as an
+// *OutputError instead of being read as a zero value. Unknown fields are
+// ignored and unknown event types are returned as *UnknownEvent.
+func (m *Message) Decode() (Event, error) {
+	var event Event
+	var required string
+
+	switch m.EventType {
+	case MessageTypeStart:
+		event = &StartEvent{}
+	case MessageTypeStage:
+		event, required = &StageEvent{}, "type"
+	case MessageTypeContent:
+		event, required = &ContentEvent{}, "content"
+	case MessageTypeContexts:
+		event, required = &ContextsEvent{}, "contexts"
+	case MessageTypeEnd:
+		event = &EndEvent{}
+	default:
+		return &UnknownEvent{Type: m.EventType, Data: m.Data}, nil
+	}
+
+	if required != "" {
+		if value, ok := m.Data[required]; !ok || value == nil {
+			return nil, m.decodeError(fmt.Errorf("missing field %q", required))
+		}
+	}
+
+	data, err := json.Marshal(m.Data)
+	if err != nil {
+		return nil, m.decodeError(err)
+	}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, m.decodeError(err)
+	}
+	return event, nil
+}
+
+func (m *Message) decodeError(err error) *OutputError {
+	return &OutputError{
+		Message: fmt.Sprintf("无法解析 %s 事件: %v", m.EventType, err),
+		Output:  m.RawJSON,
+		Err:     err,
+	}
+}
@@ -0,0 +1,111 @@
+package ragclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMessageDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Event // nil when decoding fails
+		wantErr bool
+	}{
+		{
+			name: "start",
+			line: `{"event_type":"start","data":{"status":"started","message":"开始"}}`,
+			want: &StartEvent{Status: "started", Message: "开始"},
+		},
+		{
+			name: "stage",
+			line: `{"event_type":"stage","data":{"type":"retrieval","status":"done","tokens":{"input":7,"generated":0}}}`,
+			want: &StageEvent{Stage: "retrieval", Status: "done", Tokens: &TokenInfo{Input: 7}},
+		},
+		{
+			name: "content with unknown fields",
+			line: `{"event_type":"content","data":{"content":"答案","extra":1}}`,
+			want: &ContentEvent{Content: "答案"},
+		},
+		{
+			name: "empty contexts",
+			line: `{"event_type":"contexts","data":{"contexts":[]}}`,
+			want: &ContextsEvent{Contexts: []string{}},
+		},
+		{
+			name: "end",
+			line: `{"event_type":"end","data":{"status":"completed","metadata":{"model":"v3"}}}`,
+			want: &EndEvent{Status: "completed", Metadata: map[string]interface{}{"model": "v3"}},
+		},
+		{name: "content is not a string", line: `{"event_type":"content","data":{"content":42}}`, wantErr: true},
+		{name: "contexts is not a list", line: `{"event_type":"contexts","data":{"contexts":"doc1"}}`, wantErr: true},
+		{name: "context is not a string", line: `{"event_type":"contexts","data":{"contexts":["doc1",2]}}`, wantErr: true},
+		{name: "tokens is not an object", line: `{"event_type":"stage","data":{"type":"retrieval","tokens":"many"}}`, wantErr: true},
+		{name: "token count is not a number", line: `{"event_type":"content","data":{"content":"a","tokens":{"input":"7"}}}`, wantErr: true},
+		{name: "metadata is not an object", line: `{"event_type":"end","data":{"metadata":[]}}`, wantErr: true},
+		{name: "missing content", line: `{"event_type":"content","data":{}}`, wantErr: true},
+		{name: "null content", line: `{"event_type":"content","data":{"content":null}}`, wantErr: true},
+		{name: "missing contexts", line: `{"event_type":"contexts","data":{"tokens":{"input":1}}}`, wantErr: true},
+		{name: "missing stage type", line: `{"event_type":"stage","data":{"status":"running"}}`, wantErr: true},
+		{name: "missing data", line: `{"event_type":"content"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			if err := msg.FromJSON(tt.line); err != nil {
+				t.Fatal(err)
+			}
+
+			event, err := msg.Decode()
+			if tt.wantErr {
+				var outputErr *OutputError
+				if !errors.As(err, &outputErr) || !errors.Is(err, ErrBadOutput) {
+					t.Fatalf("Decode() = %+v, %v, want an OutputError", event, err)
+				}
+				if outputErr.Output != tt.line {
+					t.Errorf("Output = %q, want the raw line", outputErr.Output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(event, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", event, tt.want)
+			}
+			if event.EventType() != msg.EventType {
+				t.Errorf("EventType() = %s, want %s", event.EventType(), msg.EventType)
+			}
+		})
+	}
+}
+
+func TestMessageDecodeUnknownEvent(t *testing.T) {
+	var msg Message
+	line := `{"event_type":"thinking","data":{"content":"思考中","step":2,"detail":{"tool":"search"}}}`
+	if err := msg.FromJSON(line); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := msg.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	unknown, ok := event.(*UnknownEvent)
+	if !ok {
+		t.Fatalf("Decode() = %T, want *UnknownEvent", event)
+	}
+	if unknown.EventType() != "thinking" {
+		t.Errorf("EventType() = %s, want thinking", unknown.EventType())
+	}
+	want := map[string]interface{}{
+		"content": "思考中",
+		"step":    float64(2),
+		"detail":  map[string]interface{}{"tool": "search"},
+	}
+	if !reflect.DeepEqual(unknown.Data, want) {
+		t.Errorf("Data = %v, want %v", unknown.Data, want)
+	}
+}
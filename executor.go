@@ -0,0 +1,221 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Executor runs auto-coder.rag invocations on behalf of RAGClient
+//
+// The default LocalExecutor forks a local process via os/exec. Custom
+// implementations can return scripted output in tests, wrap execution in a
+// sandbox or forward the invocation to a remote worker.
+//
+// Implementations must stop the invocation when ctx is done.
+type Executor interface {
+	Start(ctx context.Context, req *ExecRequest) (Process, error)
+}
+
+// ExecRequest describes a single auto-coder.rag invocation
+type ExecRequest struct {
+	// Command line, Args[0] is the command path
+	Args []string
+	// Environment in "KEY=VALUE" form
+	Env []string
+	// Standard input (may be nil)
+	Stdin io.Reader
+}
+
+// Process is a running invocation returned by Executor.Start
+//
+// Callers read Stdout and Stderr concurrently until EOF and then call Wait.
+type Process interface {
+	Stdout() io.Reader
+	Stderr() io.Reader
+
+	// Wait waits for the invocation to finish and returns its exit code.
+	// A non-nil error means the exit status could not be determined.
+	// An invocation killed by a signal reports exit code -1.
+	Wait() (int, error)
+}
+
+// LocalExecutor runs auto-coder.rag as a local subprocess via os/exec
+//
+// On unix each invocation runs in its own process group. When ctx is done
+// the whole group, including Ray workers and other children, receives
+// SIGTERM and then SIGKILL once GracePeriod has elapsed. Processes that left
+// the group (e.g. with setsid) are not signalled. On other platforms the
+// process is killed immediately.
+//
+// Output pipes still open one second after GracePeriod, e.g. because a
+// process that left the group holds them, are closed, so that a timeout or
+// cancel never waits longer than that for the output.
+//
+// Example:
+//
+//	config := ragclient.NewRAGConfig("./docs")
+//	config.Executor = &ragclient.LocalExecutor{GracePeriod: 10 * time.Second}
+type LocalExecutor struct {
+	// Time between SIGTERM and SIGKILL on timeout or cancel (default: 5s)
+	GracePeriod time.Duration
+}
+
+// defaultGracePeriod is used when LocalExecutor.GracePeriod is not set
+const defaultGracePeriod = 5 * time.Second
+
+// Start starts the command described by req
+func (e *LocalExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	if len(req.Args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	grace := e.GracePeriod
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+
+	cmd := exec.CommandContext(ctx, req.Args[0], req.Args[1:]...)
+	cmd.Env = req.Env
+	cmd.Stdin = req.Stdin
+	setProcessGroup(cmd)
+	// 宽限期后仍未写完的标准输入由 Wait 强制关闭
+	cmd.WaitDelay = grace + time.Second
+
+	// 自己创建输出管道而不使用 StdoutPipe, 以便超时后能关闭读取端
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutWriter.Close()
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	p := &localProcess{
+		cmd:    cmd,
+		grace:  grace,
+		stdout: stdout,
+		stderr: stderr,
+		done:   make(chan struct{}),
+	}
+	cmd.Cancel = p.terminate
+
+	err = cmd.Start()
+	// 写入端只保留在子进程中, 子进程全部退出后读取才会结束
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		return nil, err
+	}
+
+	go p.closePipesAfterCancel(ctx)
+	return p, nil
+}
+
+type localProcess struct {
+	cmd    *exec.Cmd
+	grace  time.Duration
+	stdout *os.File
+	stderr *os.File
+	// done is closed once Wait returns
+	done chan struct{}
+
+	mu        sync.Mutex
+	killTimer *time.Timer // SIGKILL scheduled by terminate
+	reaped    bool        // Wait is reaping or has reaped the process
+}
+
+func (p *localProcess) Stdout() io.Reader {
+	return pipeReader{p.stdout}
+}
+
+func (p *localProcess) Stderr() io.Reader {
+	return pipeReader{p.stderr}
+}
+
+func (p *localProcess) Wait() (int, error) {
+	p.beforeReap()
+	err := p.cmd.Wait()
+	close(p.done)
+	p.stdout.Close()
+	p.stderr.Close()
+
+	if p.cmd.ProcessState != nil {
+		return p.cmd.ProcessState.ExitCode(), nil
+	}
+	return -1, err
+}
+
+// closePipesAfterCancel closes the output pipes when they are still open one
+// second after the grace period that starts when ctx is done, e.g. because a
+// process that left the process group holds them
+func (p *localProcess) closePipesAfterCancel(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-p.done:
+		return
+	}
+
+	timer := time.NewTimer(p.grace + time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		p.stdout.Close()
+		p.stderr.Close()
+	case <-p.done:
+	}
+}
+
+// pipeReader reads an output pipe, reporting EOF once the pipe has been
+// closed by closePipesAfterCancel
+type pipeReader struct {
+	file *os.File
+}
+
+func (r pipeReader) Read(b []byte) (int, error) {
+	n, err := r.file.Read(b)
+	if errors.Is(err, os.ErrClosed) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// executor returns the configured executor, falling back to LocalExecutor
+func (c *RAGClient) executor() Executor {
+	if c.config.Executor != nil {
+		return c.config.Executor
+	}
+	return &LocalExecutor{}
+}
+
+// runProcess starts req, copies its output into stdout and stderr and waits
+// for it to exit. The returned error is only set when the invocation could
+// not be started or waited for; a failing command reports a non-zero exit code.
+func runProcess(ctx context.Context, executor Executor, req *ExecRequest, stdout, stderr io.Writer) (int, error) {
+	proc, err := executor.Start(ctx, req)
+	if err != nil {
+		return -1, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(stderr, proc.Stderr())
+	}()
+	io.Copy(stdout, proc.Stdout())
+	wg.Wait()
+
+	return proc.Wait()
+}
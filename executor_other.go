@@ -0,0 +1,19 @@
+//go:build !unix
+
+package ragclient
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op, process groups are only used on unix
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate kills the process, there is no graceful termination signal
+// outside unix
+func (p *localProcess) terminate() error {
+	return p.cmd.Process.Kill()
+}
+
+// beforeReap is a no-op, nothing is scheduled by terminate outside unix
+func (p *localProcess) beforeReap() {}
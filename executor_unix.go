@@ -0,0 +1,60 @@
+//go:build unix
+
+package ragclient
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts the command in its own process group, so that the
+// children it spawns can be signalled together
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate sends SIGTERM to the process group and schedules kill once the
+// grace period has elapsed
+func (p *localProcess) terminate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reaped {
+		return os.ErrProcessDone
+	}
+
+	err := syscall.Kill(-p.cmd.Process.Pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	p.killTimer = time.AfterFunc(p.grace, p.kill)
+	return err
+}
+
+// kill sends SIGKILL to the process group. Processes that left the group are
+// not signalled, nothing ties their pid to this invocation safely.
+//
+// The group id is the pid of the leader, which cannot be reused before the
+// leader is reaped, so the group is only signalled until then.
+func (p *localProcess) kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reaped {
+		return
+	}
+	syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// beforeReap is called by Wait before it reaps the leader. When a SIGKILL is
+// still scheduled it is sent right away: Wait only runs once the output is
+// closed, and after reaping the group can no longer be signalled safely.
+func (p *localProcess) beforeReap() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reaped = true
+	if p.killTimer != nil && p.killTimer.Stop() {
+		syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
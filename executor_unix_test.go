@@ -0,0 +1,224 @@
+//go:build unix
+
+package ragclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processTreeScript starts a grandchild, a grandchild that ignores SIGTERM
+// and, when $ESCAPE is set, one that leaves the process group with setsid.
+// All of them keep stdout and stderr open. Their pids are written to
+// $PIDS_FILE.
+const processTreeScript = `#!/bin/sh
+sleep 30 &
+echo $! >> "$PIDS_FILE"
+sh -c 'trap "" TERM; exec sleep 30' &
+echo $! >> "$PIDS_FILE"
+if [ -n "$ESCAPE" ]; then
+	setsid sleep 30 &
+	echo $! >> "$PIDS_FILE"
+fi
+echo started
+wait
+`
+
+// writeProcessTree writes processTreeScript and returns its path and the
+// path of the file that will hold the pids
+func writeProcessTree(t *testing.T) (script, pidsFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	script = filepath.Join(dir, "tree.sh")
+	if err := os.WriteFile(script, []byte(processTreeScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, filepath.Join(dir, "pids")
+}
+
+// readPids returns the pids written by processTreeScript
+func readPids(t *testing.T, pidsFile string) []int {
+	t.Helper()
+	content, err := os.ReadFile(pidsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// processGone reports whether pid has exited, zombies included since nothing
+// may reap orphans in a container
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err == nil {
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		return len(fields) > 0 && fields[0] == "Z"
+	}
+	return errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
+
+// assertProcessesGone fails unless every pid exits shortly
+func assertProcessesGone(t *testing.T, pids []int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for _, pid := range pids {
+		for !processGone(pid) {
+			if time.Now().After(deadline) {
+				syscall.Kill(pid, syscall.SIGKILL)
+				t.Errorf("process %d is still running", pid)
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestLocalExecutorTimeoutKillsProcessTree(t *testing.T) {
+	script, pidsFile := writeProcessTree(t)
+	const timeout = 500 * time.Millisecond
+	const grace = time.Second
+	executor := &LocalExecutor{GracePeriod: grace}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req := &ExecRequest{Args: []string{script}, Env: append(os.Environ(), "PIDS_FILE="+pidsFile)}
+	var stdout bytes.Buffer
+	start := time.Now()
+	exitCode, err := runProcess(ctx, executor, req, &stdout, io.Discard)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("runProcess() error = %v", err)
+	}
+	if exitCode == 0 {
+		t.Errorf("exit code = 0, want the code of a terminated process")
+	}
+	if stdout.String() != "started\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "started\n")
+	}
+	// 宽限期结束时发送 SIGKILL, 不应等到关闭管道的兜底时间 (宽限期 + 1 秒)
+	if limit := timeout + grace + 500*time.Millisecond; elapsed > limit {
+		t.Errorf("runProcess() returned after %v, want at most %v", elapsed, limit)
+	}
+	assertProcessesGone(t, readPids(t, pidsFile))
+}
+
+func TestQueryStreamTimeoutKillsProcessTree(t *testing.T) {
+	script, pidsFile := writeProcessTree(t)
+	const grace = time.Second
+	config := NewRAGConfig(t.TempDir())
+	config.CommandPath = script
+	config.Timeout = 1
+	config.Envs = map[string]string{"PIDS_FILE": pidsFile}
+	config.Executor = &LocalExecutor{GracePeriod: grace}
+	client, err := NewRAGClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	results, errs := client.QueryStream("问题", nil)
+	var lines []string
+	for line := range results {
+		lines = append(lines, line)
+	}
+	err = <-errs
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error = %v, want ErrTimeout", err)
+	}
+	if len(lines) != 1 || lines[0] != "started" {
+		t.Errorf("lines = %q, want [started]", lines)
+	}
+	if limit := time.Second + grace + 500*time.Millisecond; elapsed > limit {
+		t.Errorf("stream ended after %v, want at most %v", elapsed, limit)
+	}
+	assertProcessesGone(t, readPids(t, pidsFile))
+}
+
+func TestLocalExecutorClosesPipesHeldOutsideGroup(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid is not available")
+	}
+	script, pidsFile := writeProcessTree(t)
+	const timeout = 500 * time.Millisecond
+	const grace = 500 * time.Millisecond
+	executor := &LocalExecutor{GracePeriod: grace}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req := &ExecRequest{Args: []string{script}, Env: append(os.Environ(), "PIDS_FILE="+pidsFile, "ESCAPE=1")}
+	start := time.Now()
+	_, err := runProcess(ctx, executor, req, io.Discard, io.Discard)
+	elapsed := time.Since(start)
+	pids := readPids(t, pidsFile)
+	if len(pids) != 3 {
+		t.Fatalf("pids = %v, want 3", pids)
+	}
+	escaped := pids[2]
+	defer syscall.Kill(escaped, syscall.SIGKILL)
+
+	if err != nil {
+		t.Fatalf("runProcess() error = %v", err)
+	}
+	// 脱离进程组的进程仍持有管道, 宽限期 1 秒后管道被强制关闭
+	if limit := timeout + grace + time.Second + 500*time.Millisecond; elapsed > limit {
+		t.Errorf("runProcess() returned after %v, want at most %v", elapsed, limit)
+	}
+	assertProcessesGone(t, pids[:2])
+	// 只向进程组发送信号, 不会结束组外的进程
+	if processGone(escaped) {
+		t.Error("the process outside the process group was killed")
+	}
+}
+
+func TestLocalExecutorDoesNotKillAfterReap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := (&LocalExecutor{GracePeriod: time.Minute}).Start(ctx, &ExecRequest{Args: []string{"sleep", "30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	io.Copy(io.Discard, proc.Stdout())
+	io.Copy(io.Discard, proc.Stderr())
+	if _, err := proc.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := proc.(*localProcess)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.killTimer == nil {
+		t.Fatal("no SIGKILL was scheduled on cancel")
+	}
+	// 进程已被回收, 进程组 ID 可能被复用, 不能再发送 SIGKILL
+	if p.killTimer.Stop() {
+		t.Error("SIGKILL is still scheduled after Wait")
+	}
+}
+
+func TestLocalExecutorMissingCommand(t *testing.T) {
+	_, err := (&LocalExecutor{}).Start(context.Background(), &ExecRequest{Args: []string{"/nonexistent/auto-coder.rag"}})
+	if !errors.Is(err, exec.ErrNotFound) && !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Start() error = %v, want a missing command error", err)
+	}
+}
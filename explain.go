@@ -0,0 +1,131 @@
+package ragclient
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Invocation describes how a query would run auto-coder.rag
+type Invocation struct {
+	// Command line, Args[0] is the command path
+	Args []string
+	// Environment in "KEY=VALUE" form, secrets are replaced by "***"
+	Env []string
+	// Working directory of the process
+	Dir string
+	// Payload written to standard input (the question)
+	Stdin string
+	// Timeout applied to the query
+	Timeout time.Duration
+	// First byte and idle timeouts of streaming queries, zero when disabled
+	FirstByteTimeout time.Duration
+	IdleTimeout      time.Duration
+}
+
+// secretEnvMarkers are substrings of environment variable names whose values
+// are redacted, matched case-insensitively
+var secretEnvMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH", "COOKIE", "SESSION"}
+
+// Explain returns the invocation Query would run for question and options,
+// without running anything
+//
+// Options are validated exactly as Query does.
+//
+// Example:
+//
+//	inv, err := client.Explain("如何使用这个项目?", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(inv.ShellCommand())
+//	for _, env := range inv.Env {
+//	    fmt.Println(env)
+//	}
+func (c *RAGClient) Explain(question string, options *RAGQueryOptions) (*Invocation, error) {
+	if options == nil {
+		options = &RAGQueryOptions{OutputFormat: "text"}
+	}
+
+	// 与 Query 相同的验证
+	if options.OutputFormat != "text" && options.OutputFormat != "json" && options.OutputFormat != "stream-json" {
+		return nil, &ValidationError{Message: fmt.Sprintf("不支持的输出格式: %s", options.OutputFormat)}
+	}
+	if err := validateQueryOptions(c.config, options); err != nil {
+		return nil, err
+	}
+
+	timeout := c.config.Timeout
+	if options.Timeout != nil {
+		timeout = *options.Timeout
+	}
+	firstByteTimeout := c.config.FirstByteTimeout
+	if options.FirstByteTimeout != nil {
+		firstByteTimeout = *options.FirstByteTimeout
+	}
+	idleTimeout := c.config.IdleTimeout
+	if options.IdleTimeout != nil {
+		idleTimeout = *options.IdleTimeout
+	}
+
+	// 子进程继承当前工作目录
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, &RAGError{Message: fmt.Sprintf("Failed to get working directory: %v", err), Err: err}
+	}
+
+	return &Invocation{
+		Args:             c.buildCommand(options),
+		Env:              redactEnv(c.buildEnv(options)),
+		Dir:              dir,
+		Stdin:            question,
+		Timeout:          time.Duration(timeout) * time.Second,
+		FirstByteTimeout: time.Duration(firstByteTimeout) * time.Second,
+		IdleTimeout:      time.Duration(idleTimeout) * time.Second,
+	}, nil
+}
+
+// ShellCommand returns a POSIX shell command line that reproduces the
+// invocation, piping Stdin into the command. The environment is not
+// included since secrets are redacted.
+func (inv *Invocation) ShellCommand() string {
+	quoted := make([]string, len(inv.Args))
+	for i, arg := range inv.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	return fmt.Sprintf("cd %s && printf '%%s' %s | %s", shellQuote(inv.Dir), shellQuote(inv.Stdin), strings.Join(quoted, " "))
+}
+
+// redactEnv replaces the values of secret-looking variables with "***"
+func redactEnv(env []string) []string {
+	redacted := make([]string, len(env))
+	for i, entry := range env {
+		key, _, ok := strings.Cut(entry, "=")
+		if ok && isSecretEnv(key) {
+			entry = key + "=***"
+		}
+		redacted[i] = entry
+	}
+	return redacted
+}
+
+func isSecretEnv(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote single-quotes s for a POSIX shell
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,70 @@
+package ragclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExplainTimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    func(c *RAGConfig)
+		options   *RAGQueryOptions
+		total     time.Duration
+		firstByte time.Duration
+		idle      time.Duration
+	}{
+		{
+			name:  "defaults",
+			total: 300 * time.Second,
+		},
+		{
+			name: "from config",
+			config: func(c *RAGConfig) {
+				c.Timeout = 600
+				c.FirstByteTimeout = 30
+				c.IdleTimeout = 10
+			},
+			total:     600 * time.Second,
+			firstByte: 30 * time.Second,
+			idle:      10 * time.Second,
+		},
+		{
+			name: "overridden by options",
+			config: func(c *RAGConfig) {
+				c.FirstByteTimeout = 30
+				c.IdleTimeout = 10
+			},
+			options: &RAGQueryOptions{
+				OutputFormat:     "stream-json",
+				Timeout:          intPtr(60),
+				FirstByteTimeout: intPtr(5),
+				IdleTimeout:      intPtr(0),
+			},
+			total:     60 * time.Second,
+			firstByte: 5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewRAGConfig(t.TempDir())
+			if tt.config != nil {
+				tt.config(config)
+			}
+			client, err := NewRAGClientWithConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inv, err := client.Explain("问题", tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inv.Timeout != tt.total || inv.FirstByteTimeout != tt.firstByte || inv.IdleTimeout != tt.idle {
+				t.Errorf("timeouts = %v, %v, %v, want %v, %v, %v",
+					inv.Timeout, inv.FirstByteTimeout, inv.IdleTimeout, tt.total, tt.firstByte, tt.idle)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy retries queries that fail with a transient error
+//
+// Validation errors and cancelled contexts are never retried. Streaming
+// queries are only retried until the first content message (the first line
+// for text streams) has been returned, so that no answer is delivered twice.
+// A query that still fails once it has been retried returns a *RetryError
+// listing every attempt. On success the attempts are reported by
+// RAGResponse.Attempts and Stream.Attempts only, Query returns just the answer.
+//
+// Example:
+//
+//	config := ragclient.NewRAGConfig("./docs")
+//	config.RetryPolicy = ragclient.NewRetryPolicy(3)
+//	config.RetryPolicy.OnRetry = func(attempt int, err error, delay time.Duration) {
+//	    log.Printf("第 %d 次尝试失败, %v 后重试: %v", attempt, delay, err)
+//	}
+type RetryPolicy struct {
+	// Total number of attempts including the first one, values below 2
+	// disable retries
+	MaxAttempts int
+
+	// Delay before the first retry, multiplied by Multiplier for each
+	// further retry and capped at MaxBackoff. Zero values use 1s, 30s and 2.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Random variation of each delay as a fraction of it, from 0 to 1
+	Jitter float64
+
+	// Exit codes of ExecutionError that are retried in addition to the
+	// errors matched by IsTransient. Ignored when Retryable is set.
+	RetryableExitCodes []int
+	// Retryable decides whether an error is retried (optional, default:
+	// IsTransient and RetryableExitCodes)
+	Retryable func(err error) bool
+
+	// OnRetry is called before waiting delay to retry a failed attempt,
+	// attempt being its 1-based number (optional)
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// NewRetryPolicy creates a retry policy making at most maxAttempts attempts,
+// with exponential backoff from 1s to 30s and 20% jitter
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// AttemptInfo describes one attempt of a query
+type AttemptInfo struct {
+	Start    time.Time
+	Duration time.Duration
+	// Error that ended the attempt, nil for a successful attempt
+	Err error
+}
+
+// IsTransient reports whether err is likely to go away when the query is
+// retried: rate limits, network and server errors reported on stderr, and
+// first byte or idle timeouts of streaming queries
+func IsTransient(err error) bool {
+	var execErr *ExecutionError
+	if !errors.As(err, &execErr) {
+		return false
+	}
+	if execErr.TimedOut {
+		return execErr.TimeoutKind == TimeoutFirstByte || execErr.TimeoutKind == TimeoutIdle
+	}
+	if classifyStderr(execErr.Stderr) == ErrAuth {
+		return false
+	}
+	lower := strings.ToLower(execErr.Stderr)
+	for _, pattern := range transientErrorPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stderr patterns of transient failures, matched case-insensitively
+var transientErrorPatterns = []string{
+	"ratelimiterror",
+	"rate limit",
+	"rate_limit",
+	"too many requests",
+	"error code: 429",
+	"apiconnectionerror",
+	"apitimeouterror",
+	"internalservererror",
+	"error code: 500",
+	"error code: 502",
+	"error code: 503",
+	"error code: 504",
+	"service unavailable",
+	"overloaded",
+	"connection reset",
+	"connection refused",
+	"connection aborted",
+	"remotedisconnected",
+	"temporary failure in name resolution",
+}
+
+// resolveRetryPolicy returns the policy of options, falling back to config.
+// The result may be nil.
+func resolveRetryPolicy(config *RAGConfig, options *RAGQueryOptions) *RetryPolicy {
+	if options != nil && options.RetryPolicy != nil {
+		return options.RetryPolicy
+	}
+	return config.RetryPolicy
+}
+
+// shouldRetry reports whether attempt, which failed with err, is retried
+func (p *RetryPolicy) shouldRetry(ctx context.Context, attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrValidation) || errors.Is(err, ErrCanceled) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) && !execErr.TimedOut {
+		for _, code := range p.RetryableExitCodes {
+			if execErr.ExitCode == code {
+				return true
+			}
+		}
+	}
+	return IsTransient(err)
+}
+
+// backoff returns the delay before retrying attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	if delay <= 0 {
+		delay = time.Second
+	}
+	maxDelay := p.MaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	d := float64(delay)
+	for i := 1; i < attempt && d < float64(maxDelay); i++ {
+		d *= multiplier
+	}
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// notify calls OnRetry when it is set
+func (p *RetryPolicy) notify(attempt int, err error, delay time.Duration) {
+	if p.OnRetry != nil {
+		p.OnRetry(attempt, err, delay)
+	}
+}
+
+// sleepContext waits for d, returning false when ctx is done or stop is
+// closed first. stop may be nil.
+func sleepContext(ctx context.Context, d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// retryLineStream is a line stream that starts a new attempt according to a
+// RetryPolicy when the current one fails, until commit is called
+type retryLineStream struct {
+	client   *RAGClient
+	ctx      context.Context
+	question string
+	options  *RAGQueryOptions
+	policy   *RetryPolicy
+
+	// closing is closed by close, interrupting a retry backoff
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	cmd       []string
+	lines     *lineStream // current attempt, nil when it failed to start
+	err       error       // final error when the stream ended outside of lines
+	committed bool
+	pending   bool // the current attempt is not recorded in attempts yet
+	retried   bool // a retry has been scheduled, errors become RetryError
+	started   int  // attempts begun, including those that failed to start
+	attempts  []AttemptInfo
+}
+
+// startRetryLineStream starts a query whose stdout is read with next,
+// retrying failures to start according to the policy of options. The stream
+// is returned even on error so that its attempts can be inspected.
+func (c *RAGClient) startRetryLineStream(ctx context.Context, question string, options *RAGQueryOptions) (*retryLineStream, error) {
+	r := &retryLineStream{
+		client:   c,
+		ctx:      ctx,
+		question: question,
+		options:  options,
+		policy:   resolveRetryPolicy(c.config, options),
+		closing:  make(chan struct{}),
+	}
+
+	start := time.Now()
+	r.started = 1
+	lines, err := c.startLineStream(ctx, question, options)
+	if err == nil {
+		r.cmd = lines.cmd
+		r.lines = lines
+		r.pending = true
+		return r, nil
+	}
+	r.err = err
+	if !r.retry(start, err) {
+		return r, r.result()
+	}
+	return r, nil
+}
+
+// next returns the next stdout line of the current attempt, moving to the
+// next attempt when it fails and the policy allows it
+func (r *retryLineStream) next() (string, bool) {
+	for {
+		r.mu.Lock()
+		lines := r.lines
+		r.mu.Unlock()
+		if lines == nil {
+			return "", false
+		}
+
+		if line, ok := lines.next(); ok {
+			return line, true
+		}
+		if !r.retry(lines.start, lines.result()) {
+			return "", false
+		}
+	}
+}
+
+// commit stops further retries once the consumer has used the output
+func (r *retryLineStream) commit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = true
+}
+
+// retry records the attempt that just ended with err and starts the next one
+// when the policy allows it. It returns false when the stream is over.
+func (r *retryLineStream) retry(start time.Time, err error) bool {
+	for {
+		r.mu.Lock()
+		// close records a running attempt itself
+		if r.pending || r.lines == nil {
+			r.attempts = append(r.attempts, AttemptInfo{Start: start, Duration: time.Since(start), Err: err})
+			r.pending = false
+		}
+		attempt := len(r.attempts)
+		retry := err != nil && !r.committed && !r.closed() && r.policy.shouldRetry(r.ctx, attempt, err)
+		if retry {
+			r.retried = true
+		}
+		r.mu.Unlock()
+		if !retry {
+			return false
+		}
+
+		delay := r.policy.backoff(attempt)
+		r.policy.notify(attempt, err, delay)
+		if !sleepContext(r.ctx, delay, r.closing) {
+			if r.ctx.Err() != nil {
+				r.mu.Lock()
+				r.err = newCanceledError(r.ctx)
+				r.mu.Unlock()
+			}
+			return false
+		}
+
+		start = time.Now()
+		r.mu.Lock()
+		r.started++
+		r.mu.Unlock()
+		lines, startErr := r.client.startLineStream(r.ctx, r.question, r.options)
+
+		r.mu.Lock()
+		if startErr != nil {
+			r.lines = nil
+			r.err = startErr
+			r.mu.Unlock()
+			err = startErr
+			continue
+		}
+		r.cmd = lines.cmd
+		r.lines = lines
+		r.err = nil
+		r.pending = true
+		if r.closed() {
+			// close ran while the attempt was starting and did not see it
+			r.mu.Unlock()
+			lines.close()
+			return false
+		}
+		r.mu.Unlock()
+		return true
+	}
+}
+
+// closed reports whether close has been called
+func (r *retryLineStream) closed() bool {
+	select {
+	case <-r.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the current attempt and any pending retry and returns the
+// final error
+func (r *retryLineStream) close() error {
+	r.closeOnce.Do(func() { close(r.closing) })
+
+	r.mu.Lock()
+	lines := r.lines
+	r.mu.Unlock()
+	if lines != nil {
+		lines.close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending && lines != nil {
+		r.attempts = append(r.attempts, AttemptInfo{Start: lines.start, Duration: time.Since(lines.start), Err: lines.result()})
+		r.pending = false
+	}
+	return r.resultLocked()
+}
+
+// result returns the final error once the stream has finished
+func (r *retryLineStream) result() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resultLocked()
+}
+
+func (r *retryLineStream) resultLocked() error {
+	err := r.err
+	if err == nil && r.lines != nil {
+		err = r.lines.result()
+	}
+	if err != nil && r.retried {
+		return &RetryError{Attempts: append([]AttemptInfo(nil), r.attempts...), Err: err}
+	}
+	return err
+}
+
+// command returns the command line of the last attempt
+func (r *retryLineStream) command() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cmd
+}
+
+// attempt returns the number of attempts begun so far, which changes when
+// next moves to a new attempt
+func (r *retryLineStream) attempt() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.started
+}
+
+// attemptList returns a copy of the attempts recorded so far
+func (r *retryLineStream) attemptList() []AttemptInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AttemptInfo(nil), r.attempts...)
+}
@@ -0,0 +1,206 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceExecutor runs the scripted executors in turn, one per attempt
+type sequenceExecutor struct {
+	mu       sync.Mutex
+	attempts []*scriptedExecutor
+	started  int
+}
+
+func (e *sequenceExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	e.mu.Lock()
+	next := e.attempts[e.started]
+	e.started++
+	e.mu.Unlock()
+	if next == nil {
+		return nil, errors.New("spawn failed")
+	}
+	return next.Start(ctx, req)
+}
+
+// rateLimited is an attempt that fails with a transient error
+func rateLimited(stdout string) *scriptedExecutor {
+	return &scriptedExecutor{stdout: stdout, stderr: "openai.RateLimitError: Error code: 429", exitCode: 1}
+}
+
+// newRetryClient returns a client retrying up to 3 attempts without delay
+func newRetryClient(t *testing.T, executor *sequenceExecutor) *RAGClient {
+	t.Helper()
+	client := newScriptedClient(t, executor)
+	client.config.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	return client
+}
+
+func TestQueryRetryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []*scriptedExecutor
+		answer   string
+		retried  int // attempts reported by RetryError, 0 when not wrapped
+	}{
+		{
+			name:     "success after retry",
+			attempts: []*scriptedExecutor{rateLimited(""), {stdout: "答案\n"}},
+			answer:   "答案",
+		},
+		{
+			name:     "all attempts fail",
+			attempts: []*scriptedExecutor{rateLimited(""), rateLimited(""), rateLimited("")},
+			retried:  3,
+		},
+		{
+			name:     "permanent error after retry",
+			attempts: []*scriptedExecutor{rateLimited(""), {stderr: "ValueError", exitCode: 2}},
+			retried:  2,
+		},
+		{
+			name:     "permanent error is not wrapped",
+			attempts: []*scriptedExecutor{{stderr: "ValueError", exitCode: 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &sequenceExecutor{attempts: tt.attempts}
+			client := newRetryClient(t, executor)
+
+			answer, err := client.Query("问题", nil)
+			if answer != tt.answer {
+				t.Errorf("answer = %q, want %q", answer, tt.answer)
+			}
+			if executor.started != len(tt.attempts) {
+				t.Errorf("%d attempts started, want %d", executor.started, len(tt.attempts))
+			}
+			if tt.answer != "" {
+				if err != nil {
+					t.Errorf("error = %v, want nil", err)
+				}
+				return
+			}
+
+			var execErr *ExecutionError
+			if !errors.Is(err, ErrExecution) || !errors.As(err, &execErr) {
+				t.Fatalf("error = %v, want an ExecutionError", err)
+			}
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				if tt.retried != 0 {
+					t.Fatalf("error = %T, want *RetryError", err)
+				}
+				return
+			}
+			if tt.retried == 0 {
+				t.Fatalf("error = %v, want no RetryError without retry", err)
+			}
+			if len(retryErr.Attempts) != tt.retried {
+				t.Fatalf("Attempts = %d, want %d", len(retryErr.Attempts), tt.retried)
+			}
+			for i, attempt := range retryErr.Attempts {
+				if attempt.Err == nil || attempt.Start.IsZero() {
+					t.Errorf("Attempts[%d] = %+v, want a failed attempt", i, attempt)
+				}
+			}
+			if last := retryErr.Attempts[len(retryErr.Attempts)-1].Err; last != retryErr.Err {
+				t.Errorf("Err = %v, want the error of the last attempt %v", retryErr.Err, last)
+			}
+		})
+	}
+}
+
+func TestQueryCollectMessagesKeepsLastAttempt(t *testing.T) {
+	failed := `{"event_type":"stage","data":{"type":"retrieval","status":"running","tokens":{"input":100,"generated":0}}}
+{"event_type":"contexts","data":{"contexts":["doc1"]}}
+`
+	succeeded := `{"event_type":"stage","data":{"type":"retrieval","status":"done","tokens":{"input":7,"generated":0}}}
+{"event_type":"contexts","data":{"contexts":["doc2"]}}
+{"event_type":"content","data":{"content":"答案","tokens":{"input":0,"generated":3}}}
+`
+	executor := &sequenceExecutor{attempts: []*scriptedExecutor{rateLimited(failed), {stdout: succeeded}}}
+	client := newRetryClient(t, executor)
+
+	response, err := client.QueryCollectMessages("问题", nil)
+	if err != nil {
+		t.Fatalf("QueryCollectMessages() error = %v", err)
+	}
+	if !reflect.DeepEqual(response.Contexts, []string{"doc2"}) {
+		t.Errorf("Contexts = %q, want [doc2]", response.Contexts)
+	}
+	if response.Tokens.Input != 7 || response.Tokens.Generated != 3 {
+		t.Errorf("Tokens = %+v, want input 7 and generated 3", response.Tokens)
+	}
+	if len(response.Stages) != 1 || response.Stages[0].Status != "done" {
+		t.Errorf("Stages = %+v, want the stage of the last attempt", response.Stages)
+	}
+	if response.Answer != "答案" {
+		t.Errorf("Answer = %q, want %q", response.Answer, "答案")
+	}
+	if len(response.Attempts) != 2 || response.Attempts[0].Err == nil || response.Attempts[1].Err != nil {
+		t.Errorf("Attempts = %+v, want a failed and a successful attempt", response.Attempts)
+	}
+}
+
+func TestQueryCollectMessagesDropsFailedAttempt(t *testing.T) {
+	failed := `{"event_type":"stage","data":{"type":"retrieval","status":"running","tokens":{"input":100,"generated":0}}}
+{"event_type":"contexts","data":{"contexts":["doc1"]}}
+`
+	tests := []struct {
+		name string
+		last *scriptedExecutor // nil when the last attempt fails to start
+	}{
+		{name: "silent last attempt", last: rateLimited("")},
+		{name: "last attempt fails to start"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &sequenceExecutor{attempts: []*scriptedExecutor{rateLimited(failed), tt.last}}
+			client := newRetryClient(t, executor)
+			client.config.RetryPolicy.MaxAttempts = 2
+			client.config.RetryPolicy.Retryable = func(err error) bool { return true }
+
+			response, err := client.QueryCollectMessages("问题", nil)
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 2 {
+				t.Fatalf("error = %v, want a RetryError with 2 attempts", err)
+			}
+			if len(response.Contexts) != 0 || len(response.Stages) != 0 || response.Tokens != (TokenInfo{}) {
+				t.Errorf("response = Contexts %q, Stages %+v, Tokens %+v, want nothing from the failed attempt",
+					response.Contexts, response.Stages, response.Tokens)
+			}
+			if len(response.Attempts) != 2 {
+				t.Errorf("Attempts = %d, want 2", len(response.Attempts))
+			}
+		})
+	}
+}
+
+func TestStreamRetryError(t *testing.T) {
+	executor := &sequenceExecutor{attempts: []*scriptedExecutor{rateLimited(""), rateLimited("")}}
+	client := newScriptedClient(t, executor)
+	options := &RAGQueryOptions{RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}
+
+	stream, err := client.OpenStream(context.Background(), "问题", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stream.Next() {
+	}
+
+	err = stream.Close()
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 2 {
+		t.Fatalf("Close() error = %v, want a RetryError with 2 attempts", err)
+	}
+	if !errors.Is(err, ErrExecution) {
+		t.Errorf("Close() error = %v, want it to match ErrExecution", err)
+	}
+}
@@ -0,0 +1,386 @@
+package ragclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream is a pull-based stream of Message objects from a stream-json query
+//
+// Unlike QueryStreamMessages, no goroutine is left blocked when the consumer
+// stops reading: Close stops the process and releases everything the stream
+// holds. Close must always be called, it is safe to call it more than once
+// and from another goroutine while Next is blocked.
+//
+// Example:
+//
+//	stream, err := client.OpenStream(ctx, "如何使用这个项目?", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer stream.Close()
+//
+//	for stream.Next() {
+//	    msg := stream.Message()
+//	    if msg.IsContent() {
+//	        fmt.Print(msg.GetContent())
+//	    }
+//	}
+//	if err := stream.Err(); err != nil {
+//	    log.Fatal(err)
+//	}
+type Stream struct {
+	lines   *retryLineStream
+	message *Message
+}
+
+// OpenStream starts a stream-json query and returns a Stream over its messages
+//
+// Errors that prevent the process from starting are returned directly,
+// errors that happen while streaming are reported by Err and Close. With a
+// RetryPolicy, failed attempts are retried until the first content message.
+// Timeout limits the whole stream, FirstByteTimeout and IdleTimeout the wait
+// for output lines; each is reported as an ExecutionError whose TimeoutKind
+// tells which limit expired.
+func (c *RAGClient) OpenStream(ctx context.Context, question string, options *RAGQueryOptions) (*Stream, error) {
+	lines, err := c.startRetryLineStream(ctx, question, streamJSONOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{lines: lines}, nil
+}
+
+// Next advances to the next message, returning false at the end of the
+// stream or on error
+func (s *Stream) Next() bool {
+	for {
+		line, ok := s.lines.next()
+		if !ok {
+			s.message = nil
+			return false
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		message := &Message{}
+		if err := message.FromJSON(line); err != nil {
+			// Skip invalid JSON lines
+			continue
+		}
+		if message.IsContent() {
+			// 已经返回部分答案, 失败后不再重试
+			s.lines.commit()
+		}
+		s.message = message
+		return true
+	}
+}
+
+// Message returns the current message
+func (s *Stream) Message() *Message {
+	return s.message
+}
+
+// Command returns the command line that was executed
+func (s *Stream) Command() []string {
+	return s.lines.command()
+}
+
+// Attempts returns the attempts made so far, more than one when the query
+// was retried according to its RetryPolicy
+func (s *Stream) Attempts() []AttemptInfo {
+	return s.lines.attemptList()
+}
+
+// Err returns the error that ended the stream, if any
+func (s *Stream) Err() error {
+	return s.lines.result()
+}
+
+// Close stops the process if it is still running, waits for it to exit and
+// returns the same error as Err. Stopping a stream early is not an error.
+func (s *Stream) Close() error {
+	return s.lines.close()
+}
+
+// streamJSONOptions returns a copy of options with the stream-json format
+func streamJSONOptions(options *RAGQueryOptions) *RAGQueryOptions {
+	if options == nil {
+		return &RAGQueryOptions{OutputFormat: "stream-json"}
+	}
+	streamOptions := *options
+	streamOptions.OutputFormat = "stream-json"
+	return &streamOptions
+}
+
+// maxLineSize is the longest stdout line a stream accepts. Contexts events
+// carry whole documents on a single line.
+const maxLineSize = 256 * 1024 * 1024
+
+// lineStream reads the stdout of a running query line by line
+type lineStream struct {
+	ctx     context.Context // caller context, used to report cancellation
+	runCtx  context.Context // process context, expires after the total timeout
+	cancel  context.CancelFunc
+	release func() // releases the client's in-flight slot
+	cmd     []string
+	start   time.Time
+
+	proc       Process
+	stdout     io.Reader
+	scanner    *bufio.Scanner
+	stderr     bytes.Buffer
+	stderrDone chan struct{}
+
+	// stopping is set when the consumer closes the stream early, so that
+	// the process being killed is not reported as a failure
+	stopping atomic.Bool
+
+	// Limits in seconds, 0 disables the first byte and idle limits
+	timeout          int
+	firstByteTimeout int
+	idleTimeout      int
+	// expired holds the TimeoutKind of the first byte or idle watchdog that
+	// killed the process
+	expired atomic.Value
+	gotLine bool
+
+	// Circuit breaker told about the outcome, and the generation it allowed
+	// the query in
+	breaker    *circuitBreaker
+	generation uint64
+
+	mu       sync.Mutex
+	finished bool
+	err      error
+}
+
+// startLineStream starts a query whose stdout is read with next
+func (c *RAGClient) startLineStream(ctx context.Context, question string, options *RAGQueryOptions) (*lineStream, error) {
+	if err := validateQueryOptions(c.config, options); err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return nil, newCanceledError(ctx)
+	}
+
+	generation, err := c.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.acquire(ctx, options); err != nil {
+		c.breaker.record(generation, err)
+		return nil, err
+	}
+
+	cmd := c.buildCommand(options)
+	req := &ExecRequest{
+		Args:  cmd,
+		Env:   c.buildEnv(options),
+		Stdin: strings.NewReader(question),
+	}
+
+	timeout := c.config.Timeout
+	if options.Timeout != nil {
+		timeout = *options.Timeout
+	}
+	firstByteTimeout := c.config.FirstByteTimeout
+	if options.FirstByteTimeout != nil {
+		firstByteTimeout = *options.FirstByteTimeout
+	}
+	idleTimeout := c.config.IdleTimeout
+	if options.IdleTimeout != nil {
+		idleTimeout = *options.IdleTimeout
+	}
+
+	// 超时或提前停止读取时通过 runCtx 结束进程
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+
+	// 启动命令
+	start := time.Now()
+	proc, err := c.executor().Start(runCtx, req)
+	if err != nil {
+		cancel()
+		c.release()
+		if ctx.Err() != nil {
+			err = newCanceledError(ctx)
+		} else {
+			err = newStartError(fmt.Sprintf("启动命令失败: %v (命令: %s)", err, cmd[0]), cmd[0], err)
+		}
+		c.breaker.record(generation, err)
+		return nil, err
+	}
+
+	s := &lineStream{
+		ctx:              ctx,
+		runCtx:           runCtx,
+		cancel:           cancel,
+		release:          c.release,
+		cmd:              cmd,
+		start:            start,
+		proc:             proc,
+		stdout:           proc.Stdout(),
+		stderrDone:       make(chan struct{}),
+		timeout:          timeout,
+		firstByteTimeout: firstByteTimeout,
+		idleTimeout:      idleTimeout,
+		breaker:          c.breaker,
+		generation:       generation,
+	}
+	s.scanner = bufio.NewScanner(s.stdout)
+	// contexts 事件携带整篇文档, 单行可能远超默认的 64KB
+	s.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	// 异步读取 stderr
+	go func() {
+		defer close(s.stderrDone)
+		io.Copy(&s.stderr, proc.Stderr())
+	}()
+
+	return s, nil
+}
+
+// next returns the next stdout line. Once it returns false the process has
+// exited and result holds the final error.
+func (s *lineStream) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.finished {
+		return "", false
+	}
+
+	// 只计算等待输出的时间, 调用方处理消息的时间不计入
+	watchdog := s.armWatchdog()
+	ok := s.scanner.Scan()
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	if ok {
+		s.gotLine = true
+		return s.scanner.Text(), true
+	}
+	s.finish(s.scanner.Err())
+	return "", false
+}
+
+// armWatchdog starts a timer that kills the process when the next line does
+// not arrive in time: before the first line the first byte timeout counts
+// from the start of the process, then the idle timeout counts from now. The
+// idle timeout also applies to the first line when there is no first byte
+// timeout. It returns nil when no limit applies.
+func (s *lineStream) armWatchdog() *time.Timer {
+	var kind TimeoutKind
+	var wait time.Duration
+	switch {
+	case !s.gotLine && s.firstByteTimeout > 0:
+		kind = TimeoutFirstByte
+		wait = time.Until(s.start.Add(time.Duration(s.firstByteTimeout) * time.Second))
+	case s.idleTimeout > 0:
+		kind = TimeoutIdle
+		wait = time.Duration(s.idleTimeout) * time.Second
+	default:
+		return nil
+	}
+	return time.AfterFunc(wait, func() {
+		s.expired.CompareAndSwap(nil, kind)
+		s.cancel()
+	})
+}
+
+// close stops the process if it is still running and returns the final error
+func (s *lineStream) close() error {
+	// 先结束进程, 使阻塞在 next 中的读取返回
+	s.stopping.Store(true)
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.finished {
+		s.finish(nil)
+	}
+	return s.err
+}
+
+// result returns the final error once the stream has finished
+func (s *lineStream) result() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// finish drains the process output, waits for it to exit and records the
+// final error. It must be called with mu held.
+func (s *lineStream) finish(scanErr error) {
+	s.finished = true
+
+	stopped := s.stopping.Load()
+	defer func() {
+		if stopped && s.err == nil {
+			// 提前停止的查询无法判断成功与否
+			s.breaker.abandon(s.generation)
+		} else {
+			s.breaker.record(s.generation, s.err)
+		}
+	}()
+	if stopped || scanErr != nil {
+		// 不再读取输出, 结束进程并排空管道, 确保 Wait 不会阻塞
+		s.cancel()
+		io.Copy(io.Discard, s.stdout)
+	}
+	<-s.stderrDone
+
+	// 等待命令完成
+	exitCode, waitErr := s.proc.Wait()
+	s.cancel()
+	s.release()
+
+	if s.ctx.Err() != nil {
+		s.err = newCanceledError(s.ctx)
+		return
+	}
+	if scanErr != nil {
+		s.err = &RAGError{Message: fmt.Sprintf("读取输出失败: %v", scanErr), Err: scanErr}
+		return
+	}
+	if stopped {
+		return
+	}
+	if kind, ok := s.expired.Load().(TimeoutKind); ok {
+		limit := s.idleTimeout
+		if kind == TimeoutFirstByte {
+			limit = s.firstByteTimeout
+		}
+		s.err = newTimeoutError(kind, limit, s.cmd, exitCode, "", s.stderr.String(), time.Since(s.start))
+		return
+	}
+	if s.runCtx.Err() == context.DeadlineExceeded {
+		s.err = newTimeoutError(TimeoutTotal, s.timeout, s.cmd, exitCode, "", s.stderr.String(), time.Since(s.start))
+		return
+	}
+	if waitErr != nil {
+		errMsg := fmt.Sprintf("命令执行失败: %v (命令: %s)", waitErr, s.cmd[0])
+		if stderrStr := strings.TrimSpace(s.stderr.String()); stderrStr != "" {
+			errMsg += fmt.Sprintf("\n错误输出: %s", stderrStr)
+		}
+		s.err = &RAGError{Message: errMsg, Err: waitErr}
+		return
+	}
+	if exitCode != 0 {
+		// stdout 已经逐行交给调用方, 这里只保留 stderr
+		s.err = newExecutionError(s.cmd, exitCode, "", s.stderr.String(), time.Since(s.start))
+	}
+}
@@ -0,0 +1,52 @@
+//go:build go1.23
+
+package ragclient
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns an iterator over the remaining messages of the stream
+//
+// The stream is closed when the iteration ends, including when the loop body
+// breaks early. If the stream fails, the error is yielded once with a nil
+// message.
+//
+// Example:
+//
+//	for msg, err := range stream.All() {
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	    fmt.Print(msg.GetContent())
+//	}
+func (s *Stream) All() iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		defer s.Close()
+
+		for s.Next() {
+			if !yield(s.Message(), nil) {
+				return
+			}
+		}
+		if err := s.Close(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// QueryMessages executes a stream-json query and returns an iterator over
+// its messages
+//
+// The process is started when the iteration begins and stopped when it ends.
+func (c *RAGClient) QueryMessages(ctx context.Context, question string, options *RAGQueryOptions) iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		stream, err := c.OpenStream(ctx, question, options)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		stream.All()(yield)
+	}
+}
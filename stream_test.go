@@ -0,0 +1,63 @@
+package ragclient
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// scriptedExecutor returns canned output instead of running a command
+type scriptedExecutor struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func (e *scriptedExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	return &scriptedProcess{
+		stdout:   strings.NewReader(e.stdout),
+		stderr:   strings.NewReader(e.stderr),
+		exitCode: e.exitCode,
+	}, nil
+}
+
+type scriptedProcess struct {
+	stdout   io.Reader
+	stderr   io.Reader
+	exitCode int
+}
+
+func (p *scriptedProcess) Stdout() io.Reader  { return p.stdout }
+func (p *scriptedProcess) Stderr() io.Reader  { return p.stderr }
+func (p *scriptedProcess) Wait() (int, error) { return p.exitCode, nil }
+
+// newScriptedClient returns a client whose queries print stdout
+func newScriptedClient(t *testing.T, executor Executor) *RAGClient {
+	t.Helper()
+	config := NewRAGConfig(t.TempDir())
+	config.Executor = executor
+	client, err := NewRAGClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestStreamLongLine(t *testing.T) {
+	document := strings.Repeat("长文档内容 ", 20*1024) // 约 320KB
+	stdout := `{"event_type":"contexts","data":{"contexts":["` + document + `"]}}` + "\n" +
+		`{"event_type":"content","data":{"content":"ok"}}` + "\n"
+	client := newScriptedClient(t, &scriptedExecutor{stdout: stdout})
+
+	response, err := client.QueryCollectMessages("问题", nil)
+	if err != nil {
+		t.Fatalf("QueryCollectMessages() error = %v", err)
+	}
+	if len(response.Contexts) != 1 || response.Contexts[0] != document {
+		t.Errorf("Contexts = %d entries, want the %d byte document", len(response.Contexts), len(document))
+	}
+	if response.Answer != "ok" {
+		t.Errorf("Answer = %q, want %q", response.Answer, "ok")
+	}
+}
@@ -0,0 +1,332 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// model turns a pre-tokenized word into token ids
+type model interface {
+	tokenize(word string) []int
+	tokenID(token string) (int, bool)
+}
+
+// modelConfig is the union of the BPE and WordPiece fields in tokenizer.json
+type modelConfig struct {
+	Type                    string          `json:"type"`
+	Vocab                   map[string]int  `json:"vocab"`
+	Merges                  json.RawMessage `json:"merges"`
+	UnkToken                *string         `json:"unk_token"`
+	ContinuingSubwordPrefix *string         `json:"continuing_subword_prefix"`
+	EndOfWordSuffix         *string         `json:"end_of_word_suffix"`
+	FuseUnk                 bool            `json:"fuse_unk"`
+	ByteFallback            bool            `json:"byte_fallback"`
+	IgnoreMerges            bool            `json:"ignore_merges"`
+	MaxInputCharsPerWord    *int            `json:"max_input_chars_per_word"`
+}
+
+func parseModel(data json.RawMessage) (model, error) {
+	if isNull(data) {
+		return nil, fmt.Errorf("tokenizer: missing model")
+	}
+
+	var config modelConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid model: %w", err)
+	}
+
+	switch config.Type {
+	case "BPE":
+		return newBPE(&config)
+	case "WordPiece":
+		return newWordPiece(&config)
+	case "":
+		// Older files omit the type, BPE is recognized by its merges
+		if !isNull(config.Merges) {
+			return newBPE(&config)
+		}
+		if config.MaxInputCharsPerWord != nil {
+			return newWordPiece(&config)
+		}
+	}
+	return nil, fmt.Errorf("tokenizer: unsupported model %q, only BPE and WordPiece are supported", config.Type)
+}
+
+// bpeMerge is the result of merging a pair of tokens
+type bpeMerge struct {
+	rank int
+	id   int
+}
+
+// bpe is a byte-pair encoding model
+type bpe struct {
+	vocab        map[string]int
+	merges       map[[2]int]bpeMerge
+	unkID        int // -1 without unk token
+	prefix       string
+	suffix       string
+	fuseUnk      bool
+	byteFallback bool
+	ignoreMerges bool
+
+	mu    sync.Mutex
+	cache map[string][]int
+}
+
+// bpeCacheSize caps the number of cached words
+const bpeCacheSize = 10000
+
+func newBPE(config *modelConfig) (*bpe, error) {
+	m := &bpe{
+		vocab:        config.Vocab,
+		merges:       make(map[[2]int]bpeMerge),
+		unkID:        -1,
+		fuseUnk:      config.FuseUnk,
+		byteFallback: config.ByteFallback,
+		ignoreMerges: config.IgnoreMerges,
+		cache:        make(map[string][]int),
+	}
+	if config.ContinuingSubwordPrefix != nil {
+		m.prefix = *config.ContinuingSubwordPrefix
+	}
+	if config.EndOfWordSuffix != nil {
+		m.suffix = *config.EndOfWordSuffix
+	}
+	if config.UnkToken != nil {
+		id, ok := m.vocab[*config.UnkToken]
+		if !ok {
+			return nil, fmt.Errorf("tokenizer: unk_token %q is not in the vocabulary", *config.UnkToken)
+		}
+		m.unkID = id
+	}
+
+	pairs, err := parseMerges(config.Merges)
+	if err != nil {
+		return nil, err
+	}
+	for rank, pair := range pairs {
+		a, okA := m.vocab[pair[0]]
+		b, okB := m.vocab[pair[1]]
+		if !okA || !okB {
+			return nil, fmt.Errorf("tokenizer: merge %q %q uses tokens missing from the vocabulary", pair[0], pair[1])
+		}
+		merged := pair[0] + strings.TrimPrefix(pair[1], m.prefix)
+		id, ok := m.vocab[merged]
+		if !ok {
+			return nil, fmt.Errorf("tokenizer: merge result %q is not in the vocabulary", merged)
+		}
+		if _, exists := m.merges[[2]int{a, b}]; !exists {
+			m.merges[[2]int{a, b}] = bpeMerge{rank: rank, id: id}
+		}
+	}
+	return m, nil
+}
+
+// parseMerges accepts both the "a b" string form and the ["a", "b"] pair
+// form of the merges list
+func parseMerges(data json.RawMessage) ([][2]string, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid merges: %w", err)
+	}
+
+	pairs := make([][2]string, 0, len(raw))
+	for _, item := range raw {
+		var line string
+		if err := json.Unmarshal(item, &line); err == nil {
+			a, b, ok := strings.Cut(line, " ")
+			if !ok {
+				return nil, fmt.Errorf("tokenizer: invalid merge %q", line)
+			}
+			pairs = append(pairs, [2]string{a, b})
+			continue
+		}
+		var pair []string
+		if err := json.Unmarshal(item, &pair); err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("tokenizer: invalid merge %s", item)
+		}
+		pairs = append(pairs, [2]string{pair[0], pair[1]})
+	}
+	return pairs, nil
+}
+
+func (m *bpe) tokenID(token string) (int, bool) {
+	id, ok := m.vocab[token]
+	return id, ok
+}
+
+func (m *bpe) tokenize(word string) []int {
+	if word == "" {
+		return nil
+	}
+	if m.ignoreMerges {
+		if id, ok := m.vocab[word]; ok {
+			return []int{id}
+		}
+	}
+
+	m.mu.Lock()
+	ids, ok := m.cache[word]
+	m.mu.Unlock()
+	if ok {
+		return ids
+	}
+
+	ids = m.merge(m.symbols(word))
+
+	m.mu.Lock()
+	if len(m.cache) < bpeCacheSize {
+		m.cache[word] = ids
+	}
+	m.mu.Unlock()
+	return ids
+}
+
+// symbols returns the initial token ids of word, one per character
+func (m *bpe) symbols(word string) []int {
+	symbols := make([]int, 0, len(word))
+	previousUnk := false
+	for i, r := range word {
+		s := string(r)
+		if i > 0 && m.prefix != "" {
+			s = m.prefix + s
+		}
+		if i+utf8.RuneLen(r) == len(word) && m.suffix != "" {
+			s += m.suffix
+		}
+
+		if id, ok := m.vocab[s]; ok {
+			symbols = append(symbols, id)
+			previousUnk = false
+			continue
+		}
+		if m.byteFallback {
+			if fallback, ok := m.byteFallbackIDs(string(r)); ok {
+				symbols = append(symbols, fallback...)
+				previousUnk = false
+				continue
+			}
+		}
+		if m.unkID < 0 {
+			continue
+		}
+		if !(m.fuseUnk && previousUnk) {
+			symbols = append(symbols, m.unkID)
+		}
+		previousUnk = true
+	}
+	return symbols
+}
+
+// byteFallbackIDs returns the <0xXX> tokens of every byte in s
+func (m *bpe) byteFallbackIDs(s string) ([]int, bool) {
+	ids := make([]int, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		id, ok := m.vocab[fmt.Sprintf("<0x%02X>", s[i])]
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// merge applies the lowest ranked merge until none applies, leftmost first
+// when ranks tie
+func (m *bpe) merge(symbols []int) []int {
+	for len(symbols) > 1 {
+		best := -1
+		var bestMerge bpeMerge
+		for i := 0; i+1 < len(symbols); i++ {
+			merge, ok := m.merges[[2]int{symbols[i], symbols[i+1]}]
+			if ok && (best < 0 || merge.rank < bestMerge.rank) {
+				best = i
+				bestMerge = merge
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] = bestMerge.id
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+	return symbols
+}
+
+// wordPiece is a greedy longest-match-first subword model, as used by BERT
+type wordPiece struct {
+	vocab                map[string]int
+	unkID                int
+	prefix               string
+	maxInputCharsPerWord int
+}
+
+func newWordPiece(config *modelConfig) (*wordPiece, error) {
+	m := &wordPiece{
+		vocab:                config.Vocab,
+		prefix:               "##",
+		maxInputCharsPerWord: 100,
+	}
+	if config.ContinuingSubwordPrefix != nil {
+		m.prefix = *config.ContinuingSubwordPrefix
+	}
+	if config.MaxInputCharsPerWord != nil {
+		m.maxInputCharsPerWord = *config.MaxInputCharsPerWord
+	}
+
+	unkToken := "[UNK]"
+	if config.UnkToken != nil {
+		unkToken = *config.UnkToken
+	}
+	id, ok := m.vocab[unkToken]
+	if !ok {
+		return nil, fmt.Errorf("tokenizer: unk_token %q is not in the vocabulary", unkToken)
+	}
+	m.unkID = id
+	return m, nil
+}
+
+func (m *wordPiece) tokenID(token string) (int, bool) {
+	id, ok := m.vocab[token]
+	return id, ok
+}
+
+func (m *wordPiece) tokenize(word string) []int {
+	if word == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(word) > m.maxInputCharsPerWord {
+		return []int{m.unkID}
+	}
+
+	var ids []int
+	for start := 0; start < len(word); {
+		end := len(word)
+		found := -1
+		for end > start {
+			candidate := word[start:end]
+			if start > 0 {
+				candidate = m.prefix + candidate
+			}
+			if id, ok := m.vocab[candidate]; ok {
+				found = id
+				break
+			}
+			_, size := utf8.DecodeLastRuneInString(word[start:end])
+			end -= size
+		}
+		if found < 0 {
+			return []int{m.unkID}
+		}
+		ids = append(ids, found)
+		start = end
+	}
+	return ids
+}
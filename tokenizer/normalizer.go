@@ -0,0 +1,242 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// normalizer transforms text before pre-tokenization
+type normalizer interface {
+	normalize(s string) string
+}
+
+// normalizerConfig is the union of all normalizer fields in tokenizer.json
+type normalizerConfig struct {
+	Type        string            `json:"type"`
+	Normalizers []json.RawMessage `json:"normalizers"`
+	Pattern     *patternConfig    `json:"pattern"`
+	Content     string            `json:"content"`
+	Prepend     string            `json:"prepend"`
+	StripLeft   bool              `json:"strip_left"`
+	StripRight  bool              `json:"strip_right"`
+	CleanText   bool              `json:"clean_text"`
+	ChineseChar bool              `json:"handle_chinese_chars"`
+	StripAccent *bool             `json:"strip_accents"`
+	Lowercase   bool              `json:"lowercase"`
+}
+
+// patternConfig is a Split or Replace pattern, either a literal string or a
+// regular expression
+type patternConfig struct {
+	String *string `json:"String"`
+	Regex  *string `json:"Regex"`
+}
+
+// compile returns a pattern matching the literal or the regex
+func (p *patternConfig) compile() (*pattern, error) {
+	switch {
+	case p == nil:
+		return nil, fmt.Errorf("tokenizer: missing pattern")
+	case p.String != nil:
+		return &pattern{re: regexp.MustCompile(regexp.QuoteMeta(*p.String)), trailingSpace: -1}, nil
+	case p.Regex != nil:
+		return compilePattern(*p.Regex)
+	}
+	return nil, fmt.Errorf("tokenizer: empty pattern")
+}
+
+// parseNormalizer builds the normalizer described by data, appending the
+// types of the normalizers it has to skip to skipped
+func parseNormalizer(data json.RawMessage, skipped *[]string) (normalizer, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var config normalizerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid normalizer: %w", err)
+	}
+
+	switch config.Type {
+	case "Sequence":
+		var sequence normalizerSequence
+		for _, item := range config.Normalizers {
+			n, err := parseNormalizer(item, skipped)
+			if err != nil {
+				return nil, err
+			}
+			if n != nil {
+				sequence = append(sequence, n)
+			}
+		}
+		return sequence, nil
+	case "NFC", "NFD", "NFKC", "NFKD", "Precompiled":
+		// The standard library has no Unicode normalization, input is
+		// assumed to be normalized already and Tokenizer.Exact reports it
+		*skipped = append(*skipped, config.Type)
+		return nil, nil
+	case "Lowercase":
+		return lowercaseNormalizer{}, nil
+	case "StripAccents":
+		return stripAccentsNormalizer{}, nil
+	case "Strip":
+		return stripNormalizer{left: config.StripLeft, right: config.StripRight}, nil
+	case "Prepend":
+		return prependNormalizer{prepend: config.Prepend}, nil
+	case "Replace":
+		p, err := config.Pattern.compile()
+		if err != nil {
+			return nil, err
+		}
+		return replaceNormalizer{pattern: p, content: config.Content}, nil
+	case "BertNormalizer":
+		stripAccents := config.Lowercase
+		if config.StripAccent != nil {
+			stripAccents = *config.StripAccent
+		}
+		return bertNormalizer{
+			cleanText:          config.CleanText,
+			handleChineseChars: config.ChineseChar,
+			stripAccents:       stripAccents,
+			lowercase:          config.Lowercase,
+		}, nil
+	}
+	return nil, fmt.Errorf("tokenizer: unsupported normalizer %q", config.Type)
+}
+
+type normalizerSequence []normalizer
+
+func (n normalizerSequence) normalize(s string) string {
+	for _, item := range n {
+		s = item.normalize(s)
+	}
+	return s
+}
+
+type lowercaseNormalizer struct{}
+
+func (lowercaseNormalizer) normalize(s string) string {
+	return strings.ToLower(s)
+}
+
+type stripAccentsNormalizer struct{}
+
+func (stripAccentsNormalizer) normalize(s string) string {
+	return stripAccents(s)
+}
+
+type stripNormalizer struct {
+	left, right bool
+}
+
+func (n stripNormalizer) normalize(s string) string {
+	if n.left {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	}
+	if n.right {
+		s = strings.TrimRightFunc(s, unicode.IsSpace)
+	}
+	return s
+}
+
+type prependNormalizer struct {
+	prepend string
+}
+
+func (n prependNormalizer) normalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return n.prepend + s
+}
+
+type replaceNormalizer struct {
+	pattern *pattern
+	content string
+}
+
+func (n replaceNormalizer) normalize(s string) string {
+	matches := n.pattern.findAll(s)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		b.WriteString(n.content)
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// bertNormalizer implements the BERT text cleanup
+type bertNormalizer struct {
+	cleanText          bool
+	handleChineseChars bool
+	stripAccents       bool
+	lowercase          bool
+}
+
+func (n bertNormalizer) normalize(s string) string {
+	if n.cleanText || n.handleChineseChars {
+		var b strings.Builder
+		for _, r := range s {
+			switch {
+			case n.cleanText && (r == 0 || r == unicode.ReplacementChar || isControl(r)):
+				continue
+			case n.cleanText && isWhitespace(r):
+				b.WriteRune(' ')
+			case n.handleChineseChars && isChineseChar(r):
+				b.WriteRune(' ')
+				b.WriteRune(r)
+				b.WriteRune(' ')
+			default:
+				b.WriteRune(r)
+			}
+		}
+		s = b.String()
+	}
+	if n.stripAccents {
+		s = stripAccents(s)
+	}
+	if n.lowercase {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// isWhitespace reports the characters BERT treats as whitespace
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || unicode.Is(unicode.Zs, r)
+}
+
+// isControl reports control characters, excluding the whitespace ones
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co)
+}
+
+// isChineseChar reports CJK Unified Ideographs, as defined by BERT
+func isChineseChar(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B920 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
+
+// isNull reports whether a JSON value is absent or null
+func isNull(data json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(data))
+	return trimmed == "" || trimmed == "null"
+}
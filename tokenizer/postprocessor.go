@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// postProcessor adds special tokens around an encoded sequence
+type postProcessor interface {
+	process(ids []int) []int
+}
+
+// postProcessorConfig is the union of all post-processor fields in tokenizer.json
+type postProcessorConfig struct {
+	Type          string                          `json:"type"`
+	Processors    []json.RawMessage               `json:"processors"`
+	Single        []templatePiece                 `json:"single"`
+	SpecialTokens map[string]templateSpecialToken `json:"special_tokens"`
+	Cls           []json.RawMessage               `json:"cls"`
+	Sep           []json.RawMessage               `json:"sep"`
+}
+
+// templatePiece is one item of a TemplateProcessing template
+type templatePiece struct {
+	Sequence *struct {
+		ID string `json:"id"`
+	} `json:"Sequence"`
+	SpecialToken *struct {
+		ID string `json:"id"`
+	} `json:"SpecialToken"`
+}
+
+type templateSpecialToken struct {
+	IDs []int `json:"ids"`
+}
+
+func parsePostProcessor(data json.RawMessage) (postProcessor, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var config postProcessorConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid post_processor: %w", err)
+	}
+
+	switch config.Type {
+	case "Sequence":
+		var sequence postProcessorSequence
+		for _, item := range config.Processors {
+			p, err := parsePostProcessor(item)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				sequence = append(sequence, p)
+			}
+		}
+		return sequence, nil
+	case "ByteLevel":
+		// Only adjusts offsets
+		return nil, nil
+	case "TemplateProcessing":
+		var processor templateProcessor
+		for _, piece := range config.Single {
+			switch {
+			case piece.Sequence != nil:
+				processor = append(processor, nil)
+			case piece.SpecialToken != nil:
+				token, ok := config.SpecialTokens[piece.SpecialToken.ID]
+				if !ok {
+					return nil, fmt.Errorf("tokenizer: template special token %q is not defined", piece.SpecialToken.ID)
+				}
+				ids := token.IDs
+				if ids == nil {
+					ids = []int{}
+				}
+				processor = append(processor, ids)
+			default:
+				return nil, fmt.Errorf("tokenizer: invalid template piece")
+			}
+		}
+		return processor, nil
+	case "BertProcessing", "RobertaProcessing":
+		cls, err := parseSpecialTokenID(config.Cls)
+		if err != nil {
+			return nil, err
+		}
+		sep, err := parseSpecialTokenID(config.Sep)
+		if err != nil {
+			return nil, err
+		}
+		return templateProcessor{{cls}, nil, {sep}}, nil
+	}
+	return nil, fmt.Errorf("tokenizer: unsupported post_processor %q", config.Type)
+}
+
+// parseSpecialTokenID reads the id of a ["[CLS]", 101] pair
+func parseSpecialTokenID(pair []json.RawMessage) (int, error) {
+	var id int
+	if len(pair) != 2 {
+		return 0, fmt.Errorf("tokenizer: invalid special token %s", pair)
+	}
+	if err := json.Unmarshal(pair[1], &id); err != nil {
+		return 0, fmt.Errorf("tokenizer: invalid special token id %s", pair[1])
+	}
+	return id, nil
+}
+
+type postProcessorSequence []postProcessor
+
+func (p postProcessorSequence) process(ids []int) []int {
+	for _, item := range p {
+		ids = item.process(ids)
+	}
+	return ids
+}
+
+// templateProcessor lists the special token ids of a single sequence
+// template, nil marks the position of the sequence itself
+type templateProcessor [][]int
+
+func (p templateProcessor) process(ids []int) []int {
+	out := make([]int, 0, len(ids)+len(p))
+	for _, piece := range p {
+		if piece == nil {
+			out = append(out, ids...)
+		} else {
+			out = append(out, piece...)
+		}
+	}
+	return out
+}
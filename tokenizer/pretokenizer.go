@@ -0,0 +1,414 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// preTokenizer splits normalized text into the words fed to the model
+//
+// atStart reports whether pieces begin at the start of the input, as
+// opposed to after an added token.
+type preTokenizer interface {
+	preTokenize(pieces []string, atStart bool) []string
+}
+
+// preTokenizerConfig is the union of all pre-tokenizer fields in tokenizer.json
+type preTokenizerConfig struct {
+	Type             string            `json:"type"`
+	PreTokenizers    []json.RawMessage `json:"pretokenizers"`
+	Pattern          *patternConfig    `json:"pattern"`
+	Behavior         string            `json:"behavior"`
+	Invert           bool              `json:"invert"`
+	AddPrefixSpace   *bool             `json:"add_prefix_space"`
+	UseRegex         *bool             `json:"use_regex"`
+	IndividualDigits bool              `json:"individual_digits"`
+	Replacement      string            `json:"replacement"`
+	StrRep           string            `json:"str_rep"`
+	PrependScheme    string            `json:"prepend_scheme"`
+	Split            *bool             `json:"split"`
+	Delimiter        string            `json:"delimiter"`
+}
+
+func parsePreTokenizer(data json.RawMessage) (preTokenizer, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var config preTokenizerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid pre_tokenizer: %w", err)
+	}
+
+	switch config.Type {
+	case "Sequence":
+		var sequence preTokenizerSequence
+		for _, item := range config.PreTokenizers {
+			p, err := parsePreTokenizer(item)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				sequence = append(sequence, p)
+			}
+		}
+		return sequence, nil
+	case "ByteLevel":
+		return byteLevelPreTokenizer{
+			addPrefixSpace: boolOr(config.AddPrefixSpace, true),
+			useRegex:       boolOr(config.UseRegex, true),
+		}, nil
+	case "Split":
+		p, err := config.Pattern.compile()
+		if err != nil {
+			return nil, err
+		}
+		behavior, err := parseBehavior(config.Behavior)
+		if err != nil {
+			return nil, err
+		}
+		return splitPreTokenizer{pattern: p, behavior: behavior, invert: config.Invert}, nil
+	case "Whitespace":
+		p, err := compilePattern(`[\p{L}\p{M}\p{N}\p{Pc}]+|[^\p{L}\p{M}\p{N}\p{Pc}\s]+`)
+		if err != nil {
+			return nil, err
+		}
+		return splitPreTokenizer{pattern: p, behavior: removed, invert: true}, nil
+	case "WhitespaceSplit":
+		return whitespaceSplitPreTokenizer{}, nil
+	case "BertPreTokenizer":
+		return bertPreTokenizer{}, nil
+	case "Punctuation":
+		behavior := isolated
+		if config.Behavior != "" {
+			var err error
+			if behavior, err = parseBehavior(config.Behavior); err != nil {
+				return nil, err
+			}
+		}
+		return runeSplitPreTokenizer{match: isPunctuation, behavior: behavior}, nil
+	case "Digits":
+		if config.IndividualDigits {
+			return runeSplitPreTokenizer{match: unicode.IsDigit, behavior: isolated}, nil
+		}
+		return runeSplitPreTokenizer{match: unicode.IsDigit, behavior: contiguous}, nil
+	case "CharDelimiterSplit":
+		delimiter, size := utf8.DecodeRuneInString(config.Delimiter)
+		if size == 0 || size != len(config.Delimiter) {
+			return nil, fmt.Errorf("tokenizer: invalid CharDelimiterSplit delimiter %q", config.Delimiter)
+		}
+		return runeSplitPreTokenizer{match: func(r rune) bool { return r == delimiter }, behavior: removed}, nil
+	case "Metaspace":
+		replacement := config.Replacement
+		if replacement == "" {
+			replacement = config.StrRep
+		}
+		if replacement == "" {
+			replacement = "▁"
+		}
+		scheme := config.PrependScheme
+		if scheme == "" {
+			// Older files only have add_prefix_space
+			scheme = "never"
+			if boolOr(config.AddPrefixSpace, true) {
+				scheme = "always"
+			}
+		}
+		if scheme != "always" && scheme != "first" && scheme != "never" {
+			return nil, fmt.Errorf("tokenizer: unsupported Metaspace prepend_scheme %q", scheme)
+		}
+		return metaspacePreTokenizer{
+			replacement:   replacement,
+			prependScheme: scheme,
+			split:         boolOr(config.Split, true),
+		}, nil
+	}
+	return nil, fmt.Errorf("tokenizer: unsupported pre_tokenizer %q", config.Type)
+}
+
+type preTokenizerSequence []preTokenizer
+
+func (p preTokenizerSequence) preTokenize(pieces []string, atStart bool) []string {
+	for _, item := range p {
+		pieces = item.preTokenize(pieces, atStart)
+	}
+	return pieces
+}
+
+// splitBehavior decides what happens to the delimiters of a split
+type splitBehavior int
+
+const (
+	removed splitBehavior = iota
+	isolated
+	mergedWithPrevious
+	mergedWithNext
+	contiguous
+)
+
+func parseBehavior(name string) (splitBehavior, error) {
+	switch name {
+	case "Removed", "":
+		return removed, nil
+	case "Isolated":
+		return isolated, nil
+	case "MergedWithPrevious":
+		return mergedWithPrevious, nil
+	case "MergedWithNext":
+		return mergedWithNext, nil
+	case "Contiguous":
+		return contiguous, nil
+	}
+	return removed, fmt.Errorf("tokenizer: unsupported split behavior %q", name)
+}
+
+// segment is a part of a piece, either a delimiter match or the text between
+type segment struct {
+	start, end int
+	match      bool
+}
+
+// splitSegments applies behavior to the segments of s, which must cover it
+// entirely and in order
+func splitSegments(s string, segments []segment, behavior splitBehavior) []string {
+	var merged []segment
+	previousMatch := false
+	switch behavior {
+	case removed:
+		for _, seg := range segments {
+			if !seg.match {
+				merged = append(merged, seg)
+			}
+		}
+	case isolated:
+		merged = segments
+	case mergedWithPrevious:
+		for _, seg := range segments {
+			if seg.match && !previousMatch && len(merged) > 0 {
+				merged[len(merged)-1].end = seg.end
+			} else {
+				merged = append(merged, seg)
+			}
+			previousMatch = seg.match
+		}
+	case mergedWithNext:
+		for i := len(segments) - 1; i >= 0; i-- {
+			seg := segments[i]
+			if seg.match && !previousMatch && len(merged) > 0 {
+				merged[len(merged)-1].start = seg.start
+			} else {
+				merged = append(merged, seg)
+			}
+			previousMatch = seg.match
+		}
+		for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+			merged[i], merged[j] = merged[j], merged[i]
+		}
+	case contiguous:
+		for _, seg := range segments {
+			if seg.match == previousMatch && len(merged) > 0 {
+				merged[len(merged)-1].end = seg.end
+			} else {
+				merged = append(merged, seg)
+			}
+			previousMatch = seg.match
+		}
+	}
+
+	pieces := make([]string, 0, len(merged))
+	for _, seg := range merged {
+		if seg.end > seg.start {
+			pieces = append(pieces, s[seg.start:seg.end])
+		}
+	}
+	return pieces
+}
+
+// segmentsFromMatches turns match ranges into segments covering all of s
+func segmentsFromMatches(s string, matches [][2]int, invert bool) []segment {
+	var segments []segment
+	last := 0
+	for _, m := range matches {
+		if m[0] > last {
+			segments = append(segments, segment{start: last, end: m[0], match: invert})
+		}
+		segments = append(segments, segment{start: m[0], end: m[1], match: !invert})
+		last = m[1]
+	}
+	if last < len(s) {
+		segments = append(segments, segment{start: last, end: len(s), match: invert})
+	}
+	return segments
+}
+
+// splitPreTokenizer splits on a pattern
+type splitPreTokenizer struct {
+	pattern  *pattern
+	behavior splitBehavior
+	invert   bool
+}
+
+func (p splitPreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	var out []string
+	for _, piece := range pieces {
+		segments := segmentsFromMatches(piece, p.pattern.findAll(piece), p.invert)
+		out = append(out, splitSegments(piece, segments, p.behavior)...)
+	}
+	return out
+}
+
+// runeSplitPreTokenizer splits on every rune accepted by match
+type runeSplitPreTokenizer struct {
+	match    func(rune) bool
+	behavior splitBehavior
+}
+
+func (p runeSplitPreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	var out []string
+	for _, piece := range pieces {
+		var matches [][2]int
+		for i, r := range piece {
+			if p.match(r) {
+				matches = append(matches, [2]int{i, i + utf8.RuneLen(r)})
+			}
+		}
+		segments := segmentsFromMatches(piece, matches, false)
+		out = append(out, splitSegments(piece, segments, p.behavior)...)
+	}
+	return out
+}
+
+type whitespaceSplitPreTokenizer struct{}
+
+func (whitespaceSplitPreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	var out []string
+	for _, piece := range pieces {
+		out = append(out, strings.FieldsFunc(piece, unicode.IsSpace)...)
+	}
+	return out
+}
+
+// bertPreTokenizer splits on whitespace and isolates punctuation
+type bertPreTokenizer struct{}
+
+func (bertPreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	pieces = whitespaceSplitPreTokenizer{}.preTokenize(pieces, atStart)
+	return runeSplitPreTokenizer{match: isPunctuation, behavior: isolated}.preTokenize(pieces, atStart)
+}
+
+// isPunctuation reports the characters BERT treats as punctuation, which
+// include all non-alphanumeric ASCII symbols
+func isPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// metaspacePreTokenizer replaces spaces with a visible marker, as used by
+// SentencePiece models
+type metaspacePreTokenizer struct {
+	replacement   string
+	prependScheme string
+	split         bool
+}
+
+func (p metaspacePreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	var out []string
+	for i, piece := range pieces {
+		piece = strings.ReplaceAll(piece, " ", p.replacement)
+		prepend := p.prependScheme == "always" || (p.prependScheme == "first" && atStart && i == 0)
+		if prepend && !strings.HasPrefix(piece, p.replacement) {
+			piece = p.replacement + piece
+		}
+		if !p.split {
+			out = append(out, piece)
+			continue
+		}
+
+		var matches [][2]int
+		for offset := 0; offset < len(piece); {
+			index := strings.Index(piece[offset:], p.replacement)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			matches = append(matches, [2]int{start, start + len(p.replacement)})
+			offset = start + len(p.replacement)
+		}
+		segments := segmentsFromMatches(piece, matches, false)
+		out = append(out, splitSegments(piece, segments, mergedWithNext)...)
+	}
+	return out
+}
+
+// byteLevelPreTokenizer splits like GPT-2 and maps every byte to a printable
+// character, so that the BPE vocabulary never needs an unknown token
+type byteLevelPreTokenizer struct {
+	addPrefixSpace bool
+	useRegex       bool
+}
+
+func (p byteLevelPreTokenizer) preTokenize(pieces []string, atStart bool) []string {
+	var out []string
+	for _, piece := range pieces {
+		if p.addPrefixSpace && !strings.HasPrefix(piece, " ") {
+			piece = " " + piece
+		}
+		words := []string{piece}
+		if p.useRegex {
+			words = nil
+			for _, m := range byteLevelPattern.findAll(piece) {
+				words = append(words, piece[m[0]:m[1]])
+			}
+		}
+		for _, word := range words {
+			out = append(out, byteLevelEncode(word))
+		}
+	}
+	return out
+}
+
+// byteLevelPattern is the compiled gpt2Pattern
+var byteLevelPattern = func() *pattern {
+	p, err := compilePattern(gpt2Pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
+// byteLevelAlphabet maps every byte to the character GPT-2 uses for it:
+// printable Latin-1 bytes map to themselves, the others to U+0100 onwards
+var byteLevelAlphabet = func() [256]rune {
+	var alphabet [256]rune
+	next := rune(256)
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			alphabet[b] = rune(b)
+		} else {
+			alphabet[b] = next
+			next++
+		}
+	}
+	return alphabet
+}()
+
+func byteLevelEncode(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) * 2)
+	for i := 0; i < len(s); i++ {
+		b.WriteRune(byteLevelAlphabet[s[i]])
+	}
+	return b.String()
+}
+
+func boolOr(value *bool, fallback bool) bool {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,148 @@
+package tokenizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// gpt2Pattern is the pre-tokenization pattern of the GPT-2 ByteLevel
+// pre-tokenizer
+const gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// whitespaceClass is the Unicode White_Space set, which \s matches in the
+// Oniguruma patterns of tokenizer.json but not in Go regexp
+const whitespaceClass = `\t\n\v\f\r\x{85}\p{Z}`
+
+// trailingSpaceGroup names the group replacing the \s+(?!\S) lookahead
+const trailingSpaceGroup = "trailingspace"
+
+// pattern is an Oniguruma pattern translated to Go regexp syntax
+type pattern struct {
+	re *regexp.Regexp
+	// Index of the group emulating \s+(?!\S), or -1
+	trailingSpace int
+}
+
+// compilePattern translates a tokenizer.json regex into Go RE2 syntax
+//
+// Go regexp has no lookaround, so the ubiquitous `\s+(?!\S)|\s+` is emulated
+// by findAll: a whitespace run followed by a non-space keeps its last
+// character for the next match. Possessive quantifiers become greedy, and
+// \s / \S match Unicode whitespace. Other lookarounds are rejected.
+func compilePattern(expr string) (*pattern, error) {
+	translated := strings.ReplaceAll(expr, `\s+(?!\S)|\s+`, `(?P<`+trailingSpaceGroup+`>\s+)`)
+	translated = strings.ReplaceAll(translated, `\s+(?!\S)`, `(?P<`+trailingSpaceGroup+`>\s+)`)
+	for _, lookaround := range []string{"(?=", "(?!", "(?<=", "(?<!"} {
+		if strings.Contains(translated, lookaround) {
+			return nil, fmt.Errorf("tokenizer: unsupported lookaround in pattern %q", expr)
+		}
+	}
+
+	var b strings.Builder
+	inClass := false
+	afterQuantifier := false
+	prev := rune(0)
+	for i := 0; i < len(translated); {
+		r, size := utf8.DecodeRuneInString(translated[i:])
+		i += size
+
+		if r == '\\' && i < len(translated) {
+			next, nextSize := utf8.DecodeRuneInString(translated[i:])
+			i += nextSize
+			switch {
+			case next == 's' && inClass:
+				b.WriteString(whitespaceClass)
+			case next == 's':
+				b.WriteString("[" + whitespaceClass + "]")
+			case next == 'S' && inClass:
+				return nil, fmt.Errorf("tokenizer: unsupported \\S inside character class in pattern %q", expr)
+			case next == 'S':
+				b.WriteString("[^" + whitespaceClass + "]")
+			default:
+				b.WriteRune('\\')
+				b.WriteRune(next)
+				// Copy \p{...} and \x{...} whole, their closing brace is
+				// not a quantifier
+				if strings.ContainsRune("pPx", next) && strings.HasPrefix(translated[i:], "{") {
+					if end := strings.IndexByte(translated[i:], '}'); end >= 0 {
+						b.WriteString(translated[i : i+end+1])
+						i += end + 1
+					}
+				}
+			}
+			afterQuantifier = false
+			prev = next
+			continue
+		}
+
+		switch {
+		case inClass:
+			if r == ']' {
+				inClass = false
+			}
+			b.WriteRune(r)
+			afterQuantifier = false
+		case r == '[':
+			inClass = true
+			b.WriteRune(r)
+			// A leading ']' or '^]' is a literal, not the end of the class
+			if strings.HasPrefix(translated[i:], "]") {
+				b.WriteRune(']')
+				i++
+			} else if strings.HasPrefix(translated[i:], "^]") {
+				b.WriteString("^]")
+				i += 2
+			}
+			afterQuantifier = false
+		case r == '+' && afterQuantifier:
+			// Possessive quantifier, RE2 only knows greedy ones
+			afterQuantifier = false
+		case r == '*' || r == '+' || r == '}' || (r == '?' && prev != '('):
+			b.WriteRune(r)
+			afterQuantifier = r != '?' || !afterQuantifier
+		default:
+			b.WriteRune(r)
+			afterQuantifier = false
+		}
+		prev = r
+	}
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: cannot translate pattern %q: %w", expr, err)
+	}
+	return &pattern{re: re, trailingSpace: re.SubexpIndex(trailingSpaceGroup)}, nil
+}
+
+// findAll returns the byte ranges of all non-overlapping matches in s
+func (p *pattern) findAll(s string) [][2]int {
+	var matches [][2]int
+	for pos := 0; pos < len(s); {
+		loc := p.re.FindStringSubmatchIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if start == end {
+			// Skip empty matches one character at a time
+			_, size := utf8.DecodeRuneInString(s[start:])
+			pos = start + size
+			continue
+		}
+
+		// Emulate \s+(?!\S): a whitespace run followed by a non-space
+		// character leaves its last character to the next match
+		if p.trailingSpace >= 0 && loc[2*p.trailingSpace] >= 0 && end < len(s) {
+			_, size := utf8.DecodeLastRuneInString(s[start:end])
+			if end-start > size {
+				end -= size
+			}
+		}
+
+		matches = append(matches, [2]int{start, end})
+		pos = end
+	}
+	return matches
+}
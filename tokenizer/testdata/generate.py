@@ -0,0 +1,456 @@
+#!/usr/bin/env python3
+"""Generates the tokenizer fixtures and the ids expected by tokenizer_test.go.
+
+    python3 generate.py
+    python3 generate.py --real [--subprocess]
+
+Without arguments the script writes small tokenizer.json files in the formats
+of GPT-2 (byte level BPE), Qwen2 (Split regex + byte level BPE + NFC) and BERT
+(WordPiece) to this directory, with their ids in expected.json. When the
+HuggingFace `tokenizers` package is installed the ids are produced by it and
+checked against a standard library reimplementation of the same algorithms;
+otherwise only the reimplementation is used and expected.json says so in its
+"generator" field.
+
+--real downloads the tokenizer.json of real models (REAL_SOURCES) to real/,
+encodes REAL_CASES with `tokenizers`, which is then required, and writes
+real/expected.json with the tokenizers version and the revision of every
+file. With --subprocess the counts of `auto-coder.rag tools count` are
+recorded as well, together with the auto-coder.rag version.
+"""
+
+import json
+import os
+import re
+import subprocess
+import sys
+import tempfile
+import unicodedata
+import urllib.request
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+
+
+def bytes_to_unicode():
+    bs = list(range(ord("!"), ord("~") + 1)) + list(range(ord("¡"), ord("¬") + 1)) + list(range(ord("®"), ord("ÿ") + 1))
+    cs = bs[:]
+    n = 0
+    for b in range(256):
+        if b not in bs:
+            bs.append(b)
+            cs.append(256 + n)
+            n += 1
+    return dict(zip(bs, map(chr, cs)))
+
+
+BYTE_ENCODER = bytes_to_unicode()
+
+
+def byte_level(word):
+    return "".join(BYTE_ENCODER[b] for b in word.encode("utf-8"))
+
+
+def bpe_fixture(merges):
+    """Vocab with every byte, then one token per merge in rank order."""
+    vocab = {}
+    for b in range(256):
+        vocab[BYTE_ENCODER[b]] = len(vocab)
+    for merge in merges:
+        a, b = merge.split(" ")
+        if a not in vocab or b not in vocab or a + b in vocab:
+            raise SystemExit("bad merge %r" % merge)
+        vocab[a + b] = len(vocab)
+    return vocab
+
+
+GPT2_MERGES = [
+    "Ġ t", "h e", "Ġt he", "i n", "Ġ a", "e r", "l l", "o w", "Ġ w", "o r",
+    "Ġw or", "l d", "Ġwor ld", "he ll", "hell o", "Ġ 1", "Ġ Ġ",
+    "ä ¸", "ä¸ Ń", "æ ĸ", "æĸ ĩ", "' s", "Ġt o", "e n", "k en", "Ġto ken",
+]
+
+# Qwen2 merges are in byte level form as well
+QWEN_MERGES = GPT2_MERGES + ["Ġ ä¸Ń", "1 2", "12 3"]
+
+GPT2_PATTERN = r"""'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+"""
+QWEN_PATTERN = r"""(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+"""
+
+
+def gpt2_tokenizer():
+    return {
+        "version": "1.0",
+        "added_tokens": [
+            {"id": 300, "content": "<|endoftext|>", "single_word": False, "lstrip": False,
+             "rstrip": False, "normalized": False, "special": True},
+        ],
+        "normalizer": None,
+        "pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": False, "trim_offsets": True, "use_regex": True},
+        "post_processor": {"type": "ByteLevel", "add_prefix_space": True, "trim_offsets": False, "use_regex": True},
+        "decoder": {"type": "ByteLevel", "add_prefix_space": True, "trim_offsets": True, "use_regex": True},
+        "model": {
+            "type": "BPE", "dropout": None, "unk_token": None, "continuing_subword_prefix": "",
+            "end_of_word_suffix": "", "fuse_unk": False, "byte_fallback": False,
+            "vocab": pad_vocab(bpe_fixture(GPT2_MERGES), 300),
+            "merges": GPT2_MERGES,
+        },
+    }
+
+
+def qwen_tokenizer():
+    return {
+        "version": "1.0",
+        "added_tokens": [
+            {"id": 300, "content": "<|endoftext|>", "single_word": False, "lstrip": False,
+             "rstrip": False, "normalized": False, "special": True},
+            {"id": 301, "content": "<|im_start|>", "single_word": False, "lstrip": False,
+             "rstrip": False, "normalized": False, "special": True},
+        ],
+        "normalizer": {"type": "NFC"},
+        "pre_tokenizer": {"type": "Sequence", "pretokenizers": [
+            {"type": "Split", "pattern": {"Regex": QWEN_PATTERN}, "behavior": "Isolated", "invert": False},
+            {"type": "ByteLevel", "add_prefix_space": False, "trim_offsets": False, "use_regex": False},
+        ]},
+        "post_processor": {"type": "ByteLevel", "add_prefix_space": False, "trim_offsets": False, "use_regex": False},
+        "decoder": {"type": "ByteLevel", "add_prefix_space": False, "trim_offsets": False, "use_regex": False},
+        "model": {
+            "type": "BPE", "dropout": None, "unk_token": None, "continuing_subword_prefix": "",
+            "end_of_word_suffix": "", "fuse_unk": False, "byte_fallback": False,
+            "vocab": pad_vocab(bpe_fixture(QWEN_MERGES), 300),
+            "merges": QWEN_MERGES,
+        },
+    }
+
+
+def pad_vocab(vocab, size):
+    if len(vocab) > size:
+        raise SystemExit("vocab larger than %d" % size)
+    return vocab
+
+
+BERT_VOCAB = [
+    "[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]",
+    "the", "cafe", "play", "##ing", "##ed", "un", "##aff", "##able", "token",
+    "##izer", "##s", "!", ",", ".", "?", "中", "文", "hello", "world", "a",
+    "##b", "##c", "resume", "naive",
+]
+
+
+def bert_tokenizer():
+    return {
+        "version": "1.0",
+        "added_tokens": [
+            {"id": i, "content": t, "single_word": False, "lstrip": t == "[MASK]", "rstrip": False,
+             "normalized": False, "special": True}
+            for i, t in enumerate(BERT_VOCAB[:5])
+        ],
+        "normalizer": {"type": "BertNormalizer", "clean_text": True, "handle_chinese_chars": True,
+                       "strip_accents": None, "lowercase": True},
+        "pre_tokenizer": {"type": "BertPreTokenizer"},
+        "post_processor": {
+            "type": "TemplateProcessing",
+            "single": [{"SpecialToken": {"id": "[CLS]", "type_id": 0}}, {"Sequence": {"id": "A", "type_id": 0}},
+                       {"SpecialToken": {"id": "[SEP]", "type_id": 0}}],
+            "pair": [{"SpecialToken": {"id": "[CLS]", "type_id": 0}}, {"Sequence": {"id": "A", "type_id": 0}},
+                     {"SpecialToken": {"id": "[SEP]", "type_id": 0}}, {"Sequence": {"id": "B", "type_id": 1}},
+                     {"SpecialToken": {"id": "[SEP]", "type_id": 1}}],
+            "special_tokens": {
+                "[CLS]": {"id": "[CLS]", "ids": [2], "tokens": ["[CLS]"]},
+                "[SEP]": {"id": "[SEP]", "ids": [3], "tokens": ["[SEP]"]},
+            },
+        },
+        "decoder": {"type": "WordPiece", "prefix": "##", "cleanup": True},
+        "model": {"type": "WordPiece", "unk_token": "[UNK]", "continuing_subword_prefix": "##",
+                  "max_input_chars_per_word": 100, "vocab": {t: i for i, t in enumerate(BERT_VOCAB)}},
+    }
+
+
+CASES = {
+    "gpt2_bpe.json": [
+        "hello world",
+        "the token",
+        "Hello  world!",
+        "in the   world\n\nto",
+        "it's 123 tokens",
+        "中文 hello",
+        "hello<|endoftext|> world",
+    ],
+    "qwen2_bpe.json": [
+        "hello world",
+        "Hello  world!",
+        "in the   world\n\nto",
+        "IT'S 123",
+        "中文 中文",
+        "<|im_start|>hello<|endoftext|>",
+    ],
+    "bert_wordpiece.json": [
+        "Hello, World!",
+        "Café playing unaffable",
+        "Résumé naïve",
+        "中文tokenizers",
+        "abc  ab\tplayed?",
+        "the [MASK] zzz",
+    ],
+}
+
+
+# ---- standard library reference implementation -----------------------------
+
+# Python's re has no \p{..}: letters are word characters that are neither
+# digits nor "_", numbers are approximated by \d, enough for the cases above.
+def py_pattern(pattern):
+    pattern = pattern.replace(r"[^\s\p{L}\p{N}]", r"(?:[^\s\w]|_)")
+    pattern = pattern.replace(r"[^\r\n\p{L}\p{N}]", r"(?:[^\r\n\w]|_)")
+    pattern = pattern.replace(r"\p{L}", r"[^\W\d_]").replace(r"\p{N}", r"\d")
+    pattern = pattern.replace("(?i:", "(?:")
+    return re.compile(pattern, re.IGNORECASE if "(?i:" in pattern else 0)
+
+
+def qwen_split(text):
+    # The contractions are case insensitive, the rest of the pattern is not
+    contractions = re.compile(r"'(?:[sS]|[tT]|[rR][eE]|[vV][eE]|[mM]|[lL][lL]|[dD])")
+    rest = py_pattern(QWEN_PATTERN.replace(r"(?i:'s|'t|'re|'ve|'m|'ll|'d)|", ""))
+    words, i = [], 0
+    while i < len(text):
+        m = contractions.match(text, i) or rest.match(text, i)
+        words.append(m.group(0))
+        i = m.end()
+    return words
+
+
+def bpe(word, ranks):
+    parts = list(word)
+    while len(parts) > 1:
+        best = None
+        for i in range(len(parts) - 1):
+            rank = ranks.get(parts[i] + " " + parts[i + 1])
+            if rank is not None and (best is None or rank < best[0]):
+                best = (rank, i)
+        if best is None:
+            break
+        i = best[1]
+        parts[i:i + 2] = [parts[i] + parts[i + 1]]
+    return parts
+
+
+def split_added(text, added):
+    sections, i, start = [], 0, 0
+    while i < len(text):
+        for token in added:
+            if text.startswith(token, i):
+                if start < i:
+                    sections.append((text[start:i], None))
+                sections.append((token, added[token]))
+                i += len(token)
+                start = i
+                break
+        else:
+            i += 1
+    if start < len(text):
+        sections.append((text[start:], None))
+    return sections
+
+
+def reference_bpe(config, text, split):
+    vocab = config["model"]["vocab"]
+    ranks = {m: r for r, m in enumerate(config["model"]["merges"])}
+    added = {t["content"]: t["id"] for t in config["added_tokens"]}
+    ids = []
+    for section, token_id in split_added(text, added):
+        if token_id is not None:
+            ids.append(token_id)
+            continue
+        if config["normalizer"]:
+            section = unicodedata.normalize(config["normalizer"]["type"], section)
+        for word in split(section):
+            ids.extend(vocab[p] for p in bpe(byte_level(word), ranks))
+    return ids
+
+
+def bert_basic(text):
+    out = []
+    for ch in text:
+        cp = ord(ch)
+        if cp == 0 or cp == 0xFFFD or (unicodedata.category(ch).startswith("C") and ch not in "\t\n\r"):
+            continue
+        if ch in " \t\n\r" or unicodedata.category(ch) == "Zs":
+            out.append(" ")
+        elif 0x4E00 <= cp <= 0x9FFF:
+            out.append(" " + ch + " ")
+        else:
+            out.append(ch)
+    text = unicodedata.normalize("NFD", "".join(out).lower())
+    text = "".join(ch for ch in text if unicodedata.category(ch) != "Mn")
+    words = []
+    for chunk in text.split():
+        word = ""
+        for ch in chunk:
+            if is_punct(ch):
+                if word:
+                    words.append(word)
+                words.append(ch)
+                word = ""
+            else:
+                word += ch
+        if word:
+            words.append(word)
+    return words
+
+
+def is_punct(ch):
+    cp = ord(ch)
+    if 33 <= cp <= 47 or 58 <= cp <= 64 or 91 <= cp <= 96 or 123 <= cp <= 126:
+        return True
+    return unicodedata.category(ch).startswith("P")
+
+
+def wordpiece(word, vocab):
+    tokens, start = [], 0
+    while start < len(word):
+        end, found = len(word), None
+        while start < end:
+            piece = word[start:end] if start == 0 else "##" + word[start:end]
+            if piece in vocab:
+                found = piece
+                break
+            end -= 1
+        if found is None:
+            return [vocab["[UNK]"]]
+        tokens.append(vocab[found])
+        start = end
+    return tokens
+
+
+def reference_bert(config, text):
+    vocab = config["model"]["vocab"]
+    added = {"[MASK]": vocab["[MASK]"]}
+    ids = []
+    for section, token_id in split_added(text, added):
+        if token_id is not None:
+            ids.append(token_id)
+            continue
+        for word in bert_basic(section):
+            ids.extend(wordpiece(word, vocab))
+    return [vocab["[CLS]"]] + ids + [vocab["[SEP]"]]
+
+
+def reference(name, config, text):
+    if name == "gpt2_bpe.json":
+        pattern = py_pattern(GPT2_PATTERN)
+        return reference_bpe(config, text, pattern.findall)
+    if name == "qwen2_bpe.json":
+        return reference_bpe(config, text, qwen_split)
+    return reference_bert(config, text)
+
+
+# ---- real tokenizers -------------------------------------------------------
+
+# Output file in real/ -> HuggingFace repository whose tokenizer.json it is
+REAL_SOURCES = {
+    "gpt2.json": "openai-community/gpt2",
+    "bert-base-uncased.json": "google-bert/bert-base-uncased",
+}
+
+REAL_CASES = [
+    "Hello world",
+    "hello world",
+    "It's a test, isn't it? I'll see.",
+    "  leading spaces and\ttabs\n\nnew lines  ",
+    "如何使用这个项目?",
+    "Résumé naïve café",
+    "func main() { fmt.Println(\"hi\") } // 注释",
+    "12345 67.89 1e10",
+    "emoji 😀 and symbols ©®™",
+]
+
+
+def download(repo, path):
+    url = "https://huggingface.co/%s/resolve/main/tokenizer.json" % repo
+    with urllib.request.urlopen(url) as response:
+        revision = response.headers.get("X-Repo-Commit", "")
+        content = response.read()
+    with open(path, "wb") as f:
+        f.write(content)
+    return {"repo": repo, "revision": revision, "url": url}
+
+
+def subprocess_count(tokenizer_path, text):
+    with tempfile.NamedTemporaryFile("w", suffix=".txt", encoding="utf-8", delete=False) as f:
+        f.write(text)
+    try:
+        output = subprocess.run(
+            ["auto-coder.rag", "tools", "count", "--file", f.name, "--output_format", "json",
+             "--tokenizer_path", tokenizer_path],
+            check=True, capture_output=True, text=True).stdout
+        return json.loads(output)["totalTokens"]
+    finally:
+        os.unlink(f.name)
+
+
+def generate_real(with_subprocess):
+    import tokenizers
+
+    real = os.path.join(HERE, "real")
+    os.makedirs(real, exist_ok=True)
+    expected = {"generator": "tokenizers " + tokenizers.__version__, "sources": {}}
+    if with_subprocess:
+        expected["subprocess"] = subprocess.run(
+            ["auto-coder.rag", "--version"], capture_output=True, text=True).stdout.strip()
+
+    for name, repo in REAL_SOURCES.items():
+        path = os.path.join(real, name)
+        expected["sources"][name] = download(repo, path)
+        tok = tokenizers.Tokenizer.from_file(path)
+        cases = []
+        for text in REAL_CASES:
+            case = {"text": text, "ids": tok.encode(text).ids}
+            if with_subprocess:
+                case["count"] = subprocess_count(path, text)
+            cases.append(case)
+        expected[name] = cases
+
+    with open(os.path.join(real, "expected.json"), "w", encoding="utf-8") as f:
+        json.dump(expected, f, ensure_ascii=False, indent=1)
+        f.write("\n")
+
+
+def main():
+    fixtures = {
+        "gpt2_bpe.json": gpt2_tokenizer(),
+        "qwen2_bpe.json": qwen_tokenizer(),
+        "bert_wordpiece.json": bert_tokenizer(),
+    }
+    try:
+        import tokenizers
+    except ImportError:
+        tokenizers = None
+
+    expected = {}
+    for name, config in fixtures.items():
+        path = os.path.join(HERE, name)
+        with open(path, "w", encoding="utf-8") as f:
+            json.dump(config, f, ensure_ascii=False, indent=1)
+            f.write("\n")
+
+        expected[name] = []
+        for text in CASES[name]:
+            ids = reference(name, config, text)
+            if tokenizers is not None:
+                hf = tokenizers.Tokenizer.from_file(path).encode(text).ids
+                if hf != ids:
+                    raise SystemExit("%s %r: tokenizers %s, reference %s" % (name, text, hf, ids))
+            expected[name].append({"text": text, "ids": ids})
+
+    if tokenizers is not None:
+        expected["generator"] = "tokenizers " + tokenizers.__version__
+    else:
+        expected["generator"] = "generate.py reimplementation only, not checked against tokenizers"
+    with open(os.path.join(HERE, "expected.json"), "w", encoding="utf-8") as f:
+        json.dump(expected, f, ensure_ascii=False, indent=1)
+        f.write("\n")
+
+
+if __name__ == "__main__":
+    if "--real" in sys.argv[1:]:
+        generate_real("--subprocess" in sys.argv[1:])
+    else:
+        main()
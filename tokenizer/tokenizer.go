@@ -0,0 +1,271 @@
+// Package tokenizer counts tokens in-process with a HuggingFace
+// tokenizer.json file, the format TokenizerPath points to
+//
+// It avoids spawning `auto-coder.rag tools count` when only a token count is
+// needed. BPE and WordPiece models are supported, together with the common
+// normalizers, pre-tokenizers and post-processors. Unicode normalization
+// (NFC, NFKC, ...) is not available in the standard library and is skipped,
+// so counts can differ from the Python tokenizers for text that is not
+// already normalized; Tokenizer.Exact reports when this is the case.
+//
+// Example:
+//
+//	tok, err := tokenizer.LoadFile("/path/to/tokenizer.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(tok.Count("如何使用这个项目?"))
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer encodes text into token ids. It is safe for concurrent use.
+type Tokenizer struct {
+	added         *addedVocabulary
+	normalizer    normalizer
+	preTokenizer  preTokenizer
+	model         model
+	postProcessor postProcessor
+	// Unicode normalizers of tokenizer.json that are not applied
+	skipped []string
+}
+
+// FileCount is the token count of a single file
+type FileCount struct {
+	// Number of Unicode characters
+	Characters int
+	Tokens     int
+}
+
+// tokenizerFile is the subset of tokenizer.json used for encoding
+type tokenizerFile struct {
+	AddedTokens   []addedTokenConfig `json:"added_tokens"`
+	Normalizer    json.RawMessage    `json:"normalizer"`
+	PreTokenizer  json.RawMessage    `json:"pre_tokenizer"`
+	PostProcessor json.RawMessage    `json:"post_processor"`
+	Model         json.RawMessage    `json:"model"`
+}
+
+// LoadFile loads a tokenizer from a tokenizer.json file
+func LoadFile(path string) (*Tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: %w", err)
+	}
+	defer file.Close()
+
+	tok, err := Load(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w (file: %s)", err, path)
+	}
+	return tok, nil
+}
+
+// Load loads a tokenizer from tokenizer.json content
+func Load(r io.Reader) (*Tokenizer, error) {
+	var file tokenizerFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid tokenizer.json: %w", err)
+	}
+
+	tok := &Tokenizer{added: newAddedVocabulary(file.AddedTokens)}
+	var err error
+	if tok.normalizer, err = parseNormalizer(file.Normalizer, &tok.skipped); err != nil {
+		return nil, err
+	}
+	if tok.preTokenizer, err = parsePreTokenizer(file.PreTokenizer); err != nil {
+		return nil, err
+	}
+	if tok.model, err = parseModel(file.Model); err != nil {
+		return nil, err
+	}
+	if tok.postProcessor, err = parsePostProcessor(file.PostProcessor); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// Exact reports whether every step of tokenizer.json is applied. It is false
+// when a Unicode normalizer (NFC, NFKC, Precompiled, ...) is skipped, in which
+// case counts are approximate for text that is not already in that normal
+// form. ASCII text is not affected.
+//
+// Example:
+//
+//	tok, _ := tokenizer.LoadFile("/path/to/tokenizer.json")
+//	if !tok.Exact() {
+//	    log.Printf("token counts are approximate, skipped normalizers: %v", tok.SkippedNormalizers())
+//	}
+func (t *Tokenizer) Exact() bool {
+	return len(t.skipped) == 0
+}
+
+// SkippedNormalizers returns the types of the normalizers that are not
+// applied, in the order they appear in tokenizer.json
+func (t *Tokenizer) SkippedNormalizers() []string {
+	return append([]string(nil), t.skipped...)
+}
+
+// Encode returns the token ids of text. When addSpecialTokens is true the
+// post-processor adds special tokens such as [CLS] and [SEP].
+func (t *Tokenizer) Encode(text string, addSpecialTokens bool) []int {
+	var ids []int
+	for _, section := range t.added.split(text) {
+		if section.id >= 0 {
+			ids = append(ids, section.id)
+			continue
+		}
+
+		normalized := section.text
+		if t.normalizer != nil {
+			normalized = t.normalizer.normalize(normalized)
+		}
+		if normalized == "" {
+			continue
+		}
+
+		words := []string{normalized}
+		if t.preTokenizer != nil {
+			words = t.preTokenizer.preTokenize(words, section.start == 0)
+		}
+		for _, word := range words {
+			ids = append(ids, t.model.tokenize(word)...)
+		}
+	}
+
+	if addSpecialTokens && t.postProcessor != nil {
+		ids = t.postProcessor.process(ids)
+	}
+	return ids
+}
+
+// Count returns the number of tokens in text, including special tokens,
+// like auto-coder.rag does
+func (t *Tokenizer) Count(text string) int {
+	return len(t.Encode(text, true))
+}
+
+// CountFile counts the characters and tokens of a UTF-8 text file
+func (t *Tokenizer) CountFile(path string) (FileCount, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return FileCount{}, fmt.Errorf("tokenizer: %w", err)
+	}
+	if !utf8.Valid(content) {
+		return FileCount{}, fmt.Errorf("tokenizer: %s is not valid UTF-8", path)
+	}
+
+	text := string(content)
+	return FileCount{
+		Characters: utf8.RuneCountInString(text),
+		Tokens:     t.Count(text),
+	}, nil
+}
+
+// addedTokenConfig is an entry of added_tokens in tokenizer.json
+type addedTokenConfig struct {
+	ID         int    `json:"id"`
+	Content    string `json:"content"`
+	SingleWord bool   `json:"single_word"`
+	Lstrip     bool   `json:"lstrip"`
+	Rstrip     bool   `json:"rstrip"`
+}
+
+// addedVocabulary finds added tokens in raw text, before normalization
+//
+// tokenizer.json can ask for some added tokens to be matched on normalized
+// text instead; these are matched on the raw text as well, which only
+// matters for normalizers that change the tokens themselves.
+type addedVocabulary struct {
+	// Tokens by first byte, longest first
+	byFirstByte map[byte][]addedTokenConfig
+}
+
+// section is a part of the input, either an added token or text to encode
+type section struct {
+	text  string
+	start int
+	id    int // added token id, or -1
+}
+
+func newAddedVocabulary(tokens []addedTokenConfig) *addedVocabulary {
+	v := &addedVocabulary{byFirstByte: make(map[byte][]addedTokenConfig)}
+	for _, token := range tokens {
+		if token.Content == "" {
+			continue
+		}
+		first := token.Content[0]
+		v.byFirstByte[first] = append(v.byFirstByte[first], token)
+	}
+	for _, candidates := range v.byFirstByte {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return len(candidates[i].Content) > len(candidates[j].Content)
+		})
+	}
+	return v
+}
+
+// split cuts text around the leftmost longest added tokens
+func (v *addedVocabulary) split(text string) []section {
+	if len(v.byFirstByte) == 0 {
+		return []section{{text: text, id: -1}}
+	}
+
+	var sections []section
+	last := 0
+	for i := 0; i < len(text); {
+		token, ok := v.match(text, i)
+		if !ok {
+			i++
+			continue
+		}
+
+		start, end := i, i+len(token.Content)
+		if token.Lstrip {
+			start = last + len(strings.TrimRightFunc(text[last:start], unicode.IsSpace))
+		}
+		if token.Rstrip {
+			end = len(text) - len(strings.TrimLeftFunc(text[end:], unicode.IsSpace))
+		}
+		if start > last {
+			sections = append(sections, section{text: text[last:start], start: last, id: -1})
+		}
+		sections = append(sections, section{text: text[start:end], start: start, id: token.ID})
+		last, i = end, end
+	}
+	if last < len(text) {
+		sections = append(sections, section{text: text[last:], start: last, id: -1})
+	}
+	return sections
+}
+
+// match returns the longest added token starting at text[i]
+func (v *addedVocabulary) match(text string, i int) (addedTokenConfig, bool) {
+	for _, token := range v.byFirstByte[text[i]] {
+		if !strings.HasPrefix(text[i:], token.Content) {
+			continue
+		}
+		if token.SingleWord {
+			before, _ := utf8.DecodeLastRuneInString(text[:i])
+			after, _ := utf8.DecodeRuneInString(text[i+len(token.Content):])
+			if (i > 0 && isWordChar(before)) || (i+len(token.Content) < len(text) && isWordChar(after)) {
+				continue
+			}
+		}
+		return token, true
+	}
+	return addedTokenConfig{}, false
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
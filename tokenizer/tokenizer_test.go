@@ -0,0 +1,244 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// expectedCase is an entry of testdata/expected.json or
+// testdata/real/expected.json, written by testdata/generate.py
+type expectedCase struct {
+	Text string `json:"text"`
+	IDs  []int  `json:"ids"`
+	// Count is the count of auto-coder.rag tools count, when recorded
+	Count *int `json:"count"`
+}
+
+// expectedMetadata lists the keys of expected.json that are not fixtures
+var expectedMetadata = map[string]bool{"generator": true, "sources": true, "subprocess": true}
+
+func loadExpected(t *testing.T) map[string][]expectedCase {
+	t.Helper()
+	expected, err := readExpected(filepath.Join("testdata", "expected.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expected
+}
+
+func readExpected(path string) (map[string][]expectedCase, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	expected := make(map[string][]expectedCase)
+	for name, data := range raw {
+		if expectedMetadata[name] {
+			continue
+		}
+		var cases []expectedCase
+		if err := json.Unmarshal(data, &cases); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		expected[name] = cases
+	}
+	return expected, nil
+}
+
+func TestEncodeFixtures(t *testing.T) {
+	expected := loadExpected(t)
+	for _, name := range []string{"gpt2_bpe.json", "qwen2_bpe.json", "bert_wordpiece.json"} {
+		cases := expected[name]
+		if len(cases) == 0 {
+			t.Fatalf("no expected ids for %s", name)
+		}
+		tok, err := LoadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range cases {
+			t.Run(name+"/"+tc.Text, func(t *testing.T) {
+				if got := tok.Encode(tc.Text, true); !reflect.DeepEqual(got, tc.IDs) {
+					t.Errorf("Encode(%q) = %v, want %v", tc.Text, got, tc.IDs)
+				}
+				if got := tok.Count(tc.Text); got != len(tc.IDs) {
+					t.Errorf("Count(%q) = %d, want %d", tc.Text, got, len(tc.IDs))
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeWithoutSpecialTokens(t *testing.T) {
+	tok, err := LoadFile(filepath.Join("testdata", "bert_wordpiece.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hello , world !
+	want := []int{22, 17, 23, 16}
+	if got := tok.Encode("Hello, World!", false); !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+}
+
+func TestExact(t *testing.T) {
+	tests := []struct {
+		file    string
+		exact   bool
+		skipped []string
+	}{
+		{file: "gpt2_bpe.json", exact: true},
+		{file: "bert_wordpiece.json", exact: true},
+		{file: "qwen2_bpe.json", exact: false, skipped: []string{"NFC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			tok, err := LoadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tok.Exact(); got != tt.exact {
+				t.Errorf("Exact() = %v, want %v", got, tt.exact)
+			}
+			if got := tok.SkippedNormalizers(); !reflect.DeepEqual(got, tt.skipped) {
+				t.Errorf("SkippedNormalizers() = %q, want %q", got, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestCountFile(t *testing.T) {
+	tok, err := LoadFile(filepath.Join("testdata", "gpt2_bpe.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(path, []byte("中文 hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tok.CountFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FileCount{Characters: 8, Tokens: 4}); got != want {
+		t.Errorf("CountFile() = %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte{0xff, 0xfe}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tok.CountFile(path); err == nil {
+		t.Error("CountFile() of invalid UTF-8 succeeded")
+	}
+}
+
+// TestEncodeRealTokenizers checks the tokenizer.json of real models against
+// the ids of HuggingFace tokenizers, see generate.py --real
+func TestEncodeRealTokenizers(t *testing.T) {
+	expected, err := readExpected(filepath.Join("testdata", "real", "expected.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("testdata/real is missing, run: python3 testdata/generate.py --real")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("no real tokenizers in testdata/real/expected.json")
+	}
+
+	for name, cases := range expected {
+		tok, err := LoadFile(filepath.Join("testdata", "real", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tok.Exact() {
+			t.Logf("%s: normalizers %q are skipped", name, tok.SkippedNormalizers())
+		}
+		for _, tc := range cases {
+			t.Run(name+"/"+tc.Text, func(t *testing.T) {
+				if got := tok.Encode(tc.Text, true); !reflect.DeepEqual(got, tc.IDs) {
+					t.Errorf("Encode(%q) = %v, want %v", tc.Text, got, tc.IDs)
+				}
+				if tc.Count != nil && tok.Count(tc.Text) != *tc.Count {
+					t.Errorf("Count(%q) = %d, auto-coder.rag counted %d", tc.Text, tok.Count(tc.Text), *tc.Count)
+				}
+			})
+		}
+	}
+}
+
+// TestCountMatchesAutoCoderRag compares Count with auto-coder.rag tools count
+// on the fixtures, when auto-coder.rag is installed
+func TestCountMatchesAutoCoderRag(t *testing.T) {
+	command, err := exec.LookPath("auto-coder.rag")
+	if err != nil {
+		t.Skip("auto-coder.rag is not installed")
+	}
+
+	fixtures := []string{
+		filepath.Join("testdata", "gpt2_bpe.json"),
+		filepath.Join("testdata", "qwen2_bpe.json"),
+		filepath.Join("testdata", "bert_wordpiece.json"),
+	}
+	real, _ := filepath.Glob(filepath.Join("testdata", "real", "*.json"))
+	for _, path := range real {
+		if filepath.Base(path) != "expected.json" {
+			fixtures = append(fixtures, path)
+		}
+	}
+
+	expected := loadExpected(t)
+	var texts []string
+	for _, cases := range expected {
+		for _, tc := range cases {
+			texts = append(texts, tc.Text)
+		}
+	}
+	sort.Strings(texts)
+
+	for _, fixture := range fixtures {
+		tok, err := LoadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, text := range texts {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			t.Run(filepath.Base(fixture)+"/"+text, func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), fmt.Sprintf("case%d.txt", i))
+				if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				output, err := exec.Command(command, "tools", "count", "--file", file,
+					"--output_format", "json", "--tokenizer_path", fixture).Output()
+				if err != nil {
+					t.Fatalf("auto-coder.rag tools count: %v", err)
+				}
+				var result struct {
+					TotalTokens int `json:"totalTokens"`
+				}
+				if err := json.Unmarshal(output, &result); err != nil {
+					t.Fatalf("auto-coder.rag tools count output %q: %v", output, err)
+				}
+				if got := tok.Count(text); got != result.TotalTokens {
+					t.Errorf("Count(%q) = %d, auto-coder.rag counted %d", text, got, result.TotalTokens)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package ragclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CountTokens counts tokens in a file
+//
+// This is a standalone function that can be called without creating a client instance.
+// It calls `auto-coder.rag tools count --file <file_path> --output_format json` to count tokens.
+// Use options.CommandPath when auto-coder.rag is not on PATH.
+//
+// Example:
+//
+//	result, err := ragclient.CountTokens("/path/to/file.xlsx", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Total tokens: %d\n", result.TotalTokens)
+//
+//	// With options
+//	result, err := ragclient.CountTokens("/path/to/file.xlsx", &ragclient.TokenCountOptions{
+//	    CommandPath:   "/opt/venv/bin/auto-coder.rag",
+//	    TokenizerPath: "/path/to/tokenizer.json",
+//	})
+func CountTokens(filePath string, options *TokenCountOptions) (*TokenCountResult, error) {
+	if options == nil {
+		options = &TokenCountOptions{}
+	}
+	return newTokenCountSetup(options).count(filePath)
+}
+
+// tokenCountSetup is the resolved command, tokenizer and environment of a
+// `tools count` invocation
+type tokenCountSetup struct {
+	executor      Executor
+	commandPath   string
+	tokenizerPath string
+	env           []string
+	timeout       int
+}
+
+// newTokenCountSetup resolves the options of the package level CountTokens
+func newTokenCountSetup(options *TokenCountOptions) *tokenCountSetup {
+	setup := &tokenCountSetup{
+		executor:      options.Executor,
+		commandPath:   options.CommandPath,
+		tokenizerPath: options.TokenizerPath,
+		env:           mergeEnv(baseEnv(options.EnvMode, options.EnvAllowlist), false, options.Envs),
+		timeout:       options.Timeout,
+	}
+	if setup.commandPath == "" {
+		setup.commandPath = "auto-coder.rag"
+	}
+	if setup.executor == nil {
+		setup.executor = &LocalExecutor{}
+	}
+	return setup
+}
+
+// count runs `tools count` for a single file
+func (s *tokenCountSetup) count(filePath string) (*TokenCountResult, error) {
+	return countTokens(s.executor, s.commandPath, s.env, filePath, s.tokenizerPath, s.timeout)
+}
+
+// cacheKey identifies the setup in TokenCountCache keys, since another
+// command, tokenizer or environment may count differently. The executor is
+// not part of it.
+func (s *tokenCountSetup) cacheKey() string {
+	h := sha256.New()
+	for _, part := range append([]string{s.commandPath, s.tokenizerPath}, s.env...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CountTokens counts tokens in a file using the client configuration
+//
+// The command path, executor, environment layering and TokenizerPath of the
+// client config are used; options may override the tokenizer, the command
+// path, the executor and the environment mode, and its Envs are layered on
+// top of config.Envs.
+//
+// The `tools count` process counts against MaxConcurrency like a query of
+// normal priority, waiting in the same queue.
+//
+// Example:
+//
+//	result, err := client.CountTokens("/path/to/file.md", nil)
+func (c *RAGClient) CountTokens(filePath string, options *TokenCountOptions) (*TokenCountResult, error) {
+	if options == nil {
+		options = &TokenCountOptions{}
+	}
+	return c.countTokensLimited(c.tokenCountSetup(options), filePath)
+}
+
+// tokenCountSetup resolves options on top of the client configuration
+func (c *RAGClient) tokenCountSetup(options *TokenCountOptions) *tokenCountSetup {
+	setup := &tokenCountSetup{
+		executor:      c.executor(),
+		commandPath:   c.config.CommandPath,
+		tokenizerPath: c.config.TokenizerPath,
+		timeout:       options.Timeout,
+	}
+	if options.CommandPath != "" {
+		setup.commandPath = options.CommandPath
+	}
+	if options.TokenizerPath != "" {
+		setup.tokenizerPath = options.TokenizerPath
+	}
+	if options.Executor != nil {
+		setup.executor = options.Executor
+	}
+
+	envMode := c.config.EnvMode
+	if options.EnvMode != "" {
+		envMode = options.EnvMode
+	}
+	envAllowlist := c.config.EnvAllowlist
+	if options.EnvAllowlist != nil {
+		envAllowlist = options.EnvAllowlist
+	}
+	setup.env = mergeEnv(baseEnv(envMode, envAllowlist), c.config.WindowsUtf8Env, c.config.Envs, options.Envs)
+	return setup
+}
+
+// countTokensLimited counts a single file within the concurrency limit of
+// the client
+func (c *RAGClient) countTokensLimited(setup *tokenCountSetup, filePath string) (*TokenCountResult, error) {
+	// tools count 同样启动 Python 进程, 与查询共用并发限制
+	if err := c.acquire(context.Background(), &RAGQueryOptions{}); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	return setup.count(filePath)
+}
+
+// TokenCountCache caches token counts by file content hash
+//
+// Pass the same cache to repeated CountTokensDir calls so unchanged files are
+// not counted again. Entries are keyed by the content hash, the file
+// extension, the command path, the tokenizer and the environment of the
+// count; use separate caches for executors that count differently. It is
+// safe for concurrent use.
+type TokenCountCache struct {
+	mu      sync.Mutex
+	entries map[string]TokenCountFileResult
+}
+
+// NewTokenCountCache creates an empty token count cache
+func NewTokenCountCache() *TokenCountCache {
+	return &TokenCountCache{entries: make(map[string]TokenCountFileResult)}
+}
+
+func (c *TokenCountCache) get(key string) (TokenCountFileResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.entries[key]
+	return result, ok
+}
+
+func (c *TokenCountCache) put(key string, result TokenCountFileResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = result
+}
+
+// Len returns the number of cached entries
+func (c *TokenCountCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// CountTokensDir counts tokens for every file in dir matching options.RequiredExts
+//
+// Up to options.Concurrency `tools count` processes run in parallel. Hidden
+// files and directories (such as .cache) are skipped. Results are returned in
+// walk order, with one entry per file.
+//
+// A file that cannot be counted does not stop the others: the result then
+// holds the counted files and the error is a *TokenCountDirError listing the
+// failed ones. Only a missing command aborts the whole call, with a nil
+// result.
+//
+// Example:
+//
+//	cache := ragclient.NewTokenCountCache()
+//	result, err := ragclient.CountTokensDir("./docs", &ragclient.TokenCountDirOptions{
+//	    RequiredExts: ".md,.txt",
+//	    Concurrency:  8,
+//	    Cache:        cache,
+//	})
+//	var dirErr *ragclient.TokenCountDirError
+//	if errors.As(err, &dirErr) {
+//	    for _, failed := range dirErr.Files {
+//	        log.Printf("skipped %s: %v", failed.File, failed.Err)
+//	    }
+//	} else if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Total tokens: %d\n", result.TotalTokens)
+func CountTokensDir(dir string, options *TokenCountDirOptions) (*TokenCountResult, error) {
+	if options == nil {
+		options = &TokenCountDirOptions{}
+	}
+	setup := newTokenCountSetup(&options.TokenCountOptions)
+	return countTokensDir(dir, options, setup.cacheKey(), setup.count)
+}
+
+// CountTokensDir counts tokens for every matching file in dir using the client
+// configuration. An empty dir means the client's DocDir, and RequiredExts
+// defaults to the config value. Each file is counted with CountTokens, so
+// options.Concurrency is capped at MaxConcurrency. Errors are reported as by
+// the package level CountTokensDir.
+func (c *RAGClient) CountTokensDir(dir string, options *TokenCountDirOptions) (*TokenCountResult, error) {
+	if options == nil {
+		options = &TokenCountDirOptions{}
+	}
+	if dir == "" {
+		dir = c.config.DocDir
+	}
+	dirOptions := *options
+	if dirOptions.RequiredExts == "" {
+		dirOptions.RequiredExts = c.config.RequiredExts
+	}
+	// 超出 MaxConcurrency 的 worker 只会排队, 还可能因队列已满而失败
+	if limit := c.config.MaxConcurrency; limit > 0 && (dirOptions.Concurrency <= 0 || dirOptions.Concurrency > limit) {
+		dirOptions.Concurrency = limit
+	}
+	setup := c.tokenCountSetup(&dirOptions.TokenCountOptions)
+	return countTokensDir(dir, &dirOptions, setup.cacheKey(), func(filePath string) (*TokenCountResult, error) {
+		return c.countTokensLimited(setup, filePath)
+	})
+}
+
+// countTokensDir walks dir and counts the matching files with count, using a
+// bounded worker pool and the optional cache. setupKey identifies the command,
+// tokenizer and environment of count in cache keys.
+func countTokensDir(dir string, options *TokenCountDirOptions, setupKey string, count func(filePath string) (*TokenCountResult, error)) (*TokenCountResult, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, &ValidationError{Message: fmt.Sprintf("Directory does not exist: %s", dir)}
+	}
+	if !info.IsDir() {
+		return nil, &ValidationError{Message: fmt.Sprintf("Not a directory: %s", dir)}
+	}
+
+	exts := parseRequiredExts(options.RequiredExts)
+
+	// Collect files first, so results keep walk order
+	var files []string
+	err = filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() && matchesExts(entry.Name(), exts) {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &RAGError{Message: fmt.Sprintf("Failed to walk directory %s: %v", dir, err), Err: err}
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	results := make([]TokenCountFileResult, len(files))
+	fileErrs := make([]error, len(files))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		fatalErr error
+		aborted  atomic.Bool
+	)
+	jobs := make(chan int)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], fileErrs[i] = countFileTokens(files[i], options, setupKey, count)
+				// 命令不存在时其余文件也会失败, 不再继续
+				if errors.Is(fileErrs[i], ErrCommandNotFound) {
+					errOnce.Do(func() { fatalErr = fileErrs[i] })
+					aborted.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := range files {
+		if aborted.Load() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if fatalErr != nil {
+		return nil, fatalErr
+	}
+
+	total := &TokenCountResult{Files: []TokenCountFileResult{}}
+	var dirErr TokenCountDirError
+	for i, result := range results {
+		if fileErrs[i] != nil {
+			dirErr.Files = append(dirErr.Files, &TokenCountFileError{File: files[i], Err: fileErrs[i]})
+			continue
+		}
+		total.Files = append(total.Files, result)
+		total.TotalCharacters += result.Characters
+		total.TotalTokens += result.Tokens
+	}
+	if len(dirErr.Files) > 0 {
+		return total, &dirErr
+	}
+	return total, nil
+}
+
+// countFileTokens counts a single file, consulting the cache by content hash
+func countFileTokens(filePath string, options *TokenCountDirOptions, setupKey string, count func(filePath string) (*TokenCountResult, error)) (TokenCountFileResult, error) {
+	var key string
+	if options.Cache != nil {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return TokenCountFileResult{}, &RAGError{Message: fmt.Sprintf("Failed to read file %s: %v", filePath, err), Err: err}
+		}
+		sum := sha256.Sum256(content)
+		// tools count 按后缀选择解析方式, 后缀不同的相同内容可能得到不同结果
+		ext := strings.ToLower(filepath.Ext(filePath))
+		key = hex.EncodeToString(sum[:]) + "|" + ext + "|" + setupKey
+		if cached, ok := options.Cache.get(key); ok {
+			cached.File = filePath
+			return cached, nil
+		}
+	}
+
+	result, err := count(filePath)
+	if err != nil {
+		return TokenCountFileResult{}, err
+	}
+
+	fileResult := TokenCountFileResult{
+		File:       filePath,
+		Characters: result.TotalCharacters,
+		Tokens:     result.TotalTokens,
+	}
+	if options.Cache != nil {
+		options.Cache.put(key, fileResult)
+	}
+	return fileResult, nil
+}
+
+// parseRequiredExts parses a comma separated extension list such as
+// ".md,.txt" into lower-case extensions with a leading dot
+func parseRequiredExts(requiredExts string) []string {
+	var exts []string
+	for _, ext := range strings.Split(requiredExts, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// matchesExts reports whether name has one of exts, any name matches when
+// exts is empty
+func matchesExts(name string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range exts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// countTokens runs `tools count` for a single file and parses its JSON output
+func countTokens(executor Executor, commandPath string, env []string, filePath string, tokenizerPath string, timeout int) (*TokenCountResult, error) {
+	if timeout <= 0 {
+		timeout = 60
+	}
+
+	// Build command - always use JSON output format
+	cmd := []string{commandPath, "tools", "count", "--file", filePath, "--output_format", "json"}
+
+	if tokenizerPath != "" {
+		cmd = append(cmd, "--tokenizer_path", tokenizerPath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	// Execute command, only stdout carries the JSON result
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	exitCode, err := runProcess(ctx, executor, &ExecRequest{Args: cmd, Env: env}, &stdout, &stderr)
+	duration := time.Since(start)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		execErr := newExecutionError(cmd, exitCode, stdout.String(), stderr.String(), duration)
+		execErr.TimedOut = true
+		execErr.TimeoutKind = TimeoutTotal
+		execErr.Message = fmt.Sprintf("Token count timed out after %d seconds (command: %s)", timeout, cmd[0])
+		return nil, execErr
+	}
+	if err != nil {
+		return nil, newStartError(fmt.Sprintf("Error executing token count: %v", err), cmd[0], err)
+	}
+	if exitCode != 0 {
+		return nil, newExecutionError(cmd, exitCode, stdout.String(), stderr.String(), duration)
+	}
+
+	// Parse JSON output
+	return parseTokenCountJsonOutput(strings.TrimSpace(stdout.String()))
+}
+
+// parseTokenCountJsonOutput parses the JSON output from the token count command
+func parseTokenCountJsonOutput(output string) (*TokenCountResult, error) {
+	var result struct {
+		Files           []TokenCountFileResult `json:"files"`
+		TotalCharacters int                    `json:"totalCharacters"`
+		TotalTokens     int                    `json:"totalTokens"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, &OutputError{
+			Message: fmt.Sprintf("Failed to parse JSON output: %v. Output was: %s", err, output[:min(200, len(output))]),
+			Output:  output,
+			Err:     err,
+		}
+	}
+
+	return &TokenCountResult{
+		Files:           result.Files,
+		TotalCharacters: result.TotalCharacters,
+		TotalTokens:     result.TotalTokens,
+		RawOutput:       output,
+	}, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,217 @@
+package ragclient
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const tokenCountOutput = `{"files":[{"file":"a.md","characters":10,"tokens":4}],"totalCharacters":10,"totalTokens":4}`
+
+// newLimitedClient returns a client allowing one process at a time whose
+// token counts print tokenCountOutput
+func newLimitedClient(t *testing.T, maxQueueLength int) *RAGClient {
+	t.Helper()
+	config := NewRAGConfig(t.TempDir())
+	config.Executor = &scriptedExecutor{stdout: tokenCountOutput}
+	config.MaxConcurrency = 1
+	config.MaxQueueLength = maxQueueLength
+	client, err := NewRAGClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCountTokensWaitsForSlot(t *testing.T) {
+	client := newLimitedClient(t, 0)
+	if err := client.acquire(context.Background(), &RAGQueryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.CountTokens("a.md", nil)
+		done <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for client.Stats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("CountTokens did not wait for the running query")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("CountTokens() returned %v while the slot was taken", err)
+	default:
+	}
+
+	client.release()
+	if err := <-done; err != nil {
+		t.Fatalf("CountTokens() error = %v", err)
+	}
+	if stats := client.Stats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Stats() = %+v after CountTokens, want no running or queued query", stats)
+	}
+}
+
+func TestCountTokensQueueFull(t *testing.T) {
+	client := newLimitedClient(t, 1)
+	if err := client.acquire(context.Background(), &RAGQueryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	defer client.release()
+	client.mu.Lock()
+	client.enqueue(&waiter{ready: make(chan struct{})})
+	client.mu.Unlock()
+
+	if _, err := client.CountTokens("a.md", nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("CountTokens() error = %v, want ErrQueueFull", err)
+	}
+}
+
+// slowExecutor delays the start of every process
+type slowExecutor struct {
+	Executor
+	delay time.Duration
+}
+
+func (e *slowExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	time.Sleep(e.delay)
+	return e.Executor.Start(ctx, req)
+}
+
+func TestCountTokensDirRespectsMaxConcurrency(t *testing.T) {
+	client := newLimitedClient(t, 1)
+	client.config.Executor = &slowExecutor{Executor: client.config.Executor, delay: 20 * time.Millisecond}
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md", "d.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("text"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 8 个 worker 共用 1 个名额和长度为 1 的队列, 不限制时会因队列已满而失败
+	result, err := client.CountTokensDir(dir, &TokenCountDirOptions{RequiredExts: ".md", Concurrency: 8})
+	if err != nil {
+		t.Fatalf("CountTokensDir() error = %v", err)
+	}
+	if result.TotalTokens != 16 {
+		t.Errorf("TotalTokens = %d, want 16", result.TotalTokens)
+	}
+}
+
+// writeFiles creates the files in dir with the given contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCountTokensDirCache(t *testing.T) {
+	dir := t.TempDir()
+	// a.md 与 b.md 内容相同, c.txt 内容相同但后缀不同
+	writeFiles(t, dir, map[string]string{"a.md": "text", "b.md": "text", "c.txt": "text"})
+	executor := &countingExecutor{Executor: &scriptedExecutor{stdout: tokenCountOutput}}
+	cache := NewTokenCountCache()
+
+	tests := []struct {
+		name    string
+		change  func(options *TokenCountDirOptions)
+		started int32 // processes started by this call
+	}{
+		{name: "cold cache", started: 2},
+		{name: "warm cache", started: 0},
+		{name: "content changed", change: func(*TokenCountDirOptions) { writeFiles(t, dir, map[string]string{"a.md": "new text"}) }, started: 1},
+		{name: "other tokenizer", change: func(o *TokenCountDirOptions) { o.TokenizerPath = "/models/tokenizer.json" }, started: 3},
+		{name: "other command", change: func(o *TokenCountDirOptions) { o.CommandPath = "/opt/bin/auto-coder.rag" }, started: 3},
+		{name: "other envs", change: func(o *TokenCountDirOptions) { o.Envs = map[string]string{"HF_HOME": "/cache"} }, started: 3},
+		{name: "same settings again", started: 0},
+	}
+
+	options := &TokenCountDirOptions{Concurrency: 1, Cache: cache}
+	options.Executor = executor
+	for _, tt := range tests {
+		if tt.change != nil {
+			tt.change(options)
+		}
+		before := executor.started.Load()
+		result, err := CountTokensDir(dir, options)
+		if err != nil {
+			t.Fatalf("%s: CountTokensDir() error = %v", tt.name, err)
+		}
+		if started := executor.started.Load() - before; started != tt.started {
+			t.Errorf("%s: %d processes started, want %d", tt.name, started, tt.started)
+		}
+		if len(result.Files) != 3 || result.TotalTokens != 12 {
+			t.Fatalf("%s: result = %+v, want 3 files and 12 tokens", tt.name, result)
+		}
+		for i, name := range []string{"a.md", "b.md", "c.txt"} {
+			if got := filepath.Base(result.Files[i].File); got != name {
+				t.Errorf("%s: Files[%d] = %s, want %s", tt.name, i, got, name)
+			}
+		}
+	}
+}
+
+// fileExecutor runs the scripted executor of the counted file, by base name
+type fileExecutor map[string]*scriptedExecutor
+
+func (e fileExecutor) Start(ctx context.Context, req *ExecRequest) (Process, error) {
+	for i, arg := range req.Args {
+		if arg == "--file" && i+1 < len(req.Args) {
+			return e[filepath.Base(req.Args[i+1])].Start(ctx, req)
+		}
+	}
+	return nil, errors.New("no --file argument")
+}
+
+func TestCountTokensDirReportsFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.md": "a", "b.md": "b", "c.md": "c"})
+	options := &TokenCountDirOptions{}
+	options.Executor = fileExecutor{
+		"a.md": {stdout: tokenCountOutput},
+		"b.md": {stderr: "UnicodeDecodeError", exitCode: 1},
+		"c.md": {stdout: tokenCountOutput},
+	}
+
+	result, err := CountTokensDir(dir, options)
+	var dirErr *TokenCountDirError
+	if !errors.As(err, &dirErr) || len(dirErr.Files) != 1 {
+		t.Fatalf("CountTokensDir() error = %v, want a TokenCountDirError for one file", err)
+	}
+	if filepath.Base(dirErr.Files[0].File) != "b.md" || !errors.Is(err, ErrExecution) {
+		t.Errorf("Files[0] = %v, want the execution error of b.md", dirErr.Files[0])
+	}
+	if result == nil || len(result.Files) != 2 || result.TotalTokens != 8 {
+		t.Fatalf("result = %+v, want the 2 counted files", result)
+	}
+	if filepath.Base(result.Files[0].File) != "a.md" || filepath.Base(result.Files[1].File) != "c.md" {
+		t.Errorf("Files = %+v, want a.md and c.md", result.Files)
+	}
+}
+
+func TestCountTokensDirMissingCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.md": "a", "b.md": "b"})
+	options := &TokenCountDirOptions{Concurrency: 1}
+	options.CommandPath = filepath.Join(dir, "missing", "auto-coder.rag")
+
+	result, err := CountTokensDir(dir, options)
+	if !errors.Is(err, ErrCommandNotFound) || result != nil {
+		t.Errorf("CountTokensDir() = %+v, %v, want ErrCommandNotFound", result, err)
+	}
+	var dirErr *TokenCountDirError
+	if errors.As(err, &dirErr) {
+		t.Errorf("CountTokensDir() error = %v, want the error of the command", err)
+	}
+}
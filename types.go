@@ -10,56 +10,86 @@ import (
 
 // RAGConfig represents the RAG configuration
 type RAGConfig struct {
-	DocDir string
+	DocDir string `json:"doc_dir"`
 
 	// Command path (optional, default is "auto-coder.rag")
-	CommandPath string
+	CommandPath string `json:"command_path"`
 
 	// Model configuration
-	Model string
-	
+	Model string `json:"model"`
+
 	// Model configuration file path
-	ModelFile string
-	
+	ModelFile string `json:"model_file"`
+
 	// Timeout configuration (seconds)
-	Timeout int
+	Timeout int `json:"timeout"`
+
+	// Streaming timeouts in seconds, 0 disables them: time to the first
+	// output line, and maximum silence between two output lines
+	FirstByteTimeout int `json:"first_byte_timeout"`
+	IdleTimeout      int `json:"idle_timeout"`
+
+	// Concurrency limit, 0 means unlimited: at most MaxConcurrency queries
+	// and client token counts run at once, the others wait in a queue of at
+	// most MaxQueueLength for up to QueueTimeout seconds (0: until their
+	// context is done)
+	MaxConcurrency int `json:"max_concurrency"`
+	MaxQueueLength int `json:"max_queue_length"`
+	QueueTimeout   int `json:"queue_timeout"`
 
 	// RAG parameters
-	RagContextWindowLimit  int
-	FullTextRatio          float64
-	SegmentRatio           float64
-	RagDocFilterRelevance  float64
+	RagContextWindowLimit int     `json:"rag_context_window_limit"`
+	FullTextRatio         float64 `json:"full_text_ratio"`
+	SegmentRatio          float64 `json:"segment_ratio"`
+	RagDocFilterRelevance float64 `json:"rag_doc_filter_relevance"`
 
 	// Mode selection
-	Agentic     bool
-	ProductMode string // "lite" or "pro"
+	Agentic     bool   `json:"agentic"`
+	ProductMode string `json:"product_mode"` // "lite" or "pro"
 
 	// Index configuration
-	EnableHybridIndex      bool
-	DisableAutoWindow      bool
-	DisableSegmentReorder  bool
+	EnableHybridIndex     bool `json:"enable_hybrid_index"`
+	DisableAutoWindow     bool `json:"disable_auto_window"`
+	DisableSegmentReorder bool `json:"disable_segment_reorder"`
 
 	// Optional model configuration
-	RecallModel        string
-	ChunkModel         string
-	QAModel            string
-	EmbModel           string
-	AgenticModel       string
-	ContextPruneModel  string
+	RecallModel       string `json:"recall_model"`
+	ChunkModel        string `json:"chunk_model"`
+	QAModel           string `json:"qa_model"`
+	EmbModel          string `json:"emb_model"`
+	AgenticModel      string `json:"agentic_model"`
+	ContextPruneModel string `json:"context_prune_model"`
 
 	// Tokenizer path
-	TokenizerPath string
+	TokenizerPath string `json:"tokenizer_path"`
 
 	// Other parameters
-	RequiredExts string
-	RayAddress   string
-	
+	RequiredExts string `json:"required_exts"`
+	// Ray cluster address passed as --ray_address, omitted when empty
+	RayAddress string `json:"ray_address"`
+
 	// Environment variables for subprocess
-	Envs map[string]string
-	
+	Envs map[string]string `json:"envs,omitempty"`
+
+	// Environment the subprocess starts from before Envs are applied
+	// (default: EnvModeInherit, the whole environment of the Go process)
+	EnvMode EnvMode `json:"env_mode,omitempty"`
+	// Variables inherited in EnvModeAllowlist mode besides PATH, HOME and LANG
+	EnvAllowlist []string `json:"env_allowlist,omitempty"`
+
 	// Automatically add Windows UTF-8 environment variables (default: false)
 	// When true on Windows, adds: PYTHONIOENCODING=utf-8, LANG=zh_CN.UTF-8, LC_ALL=zh_CN.UTF-8, CHCP=65001
-	WindowsUtf8Env bool
+	WindowsUtf8Env bool `json:"windows_utf8_env"`
+
+	// Executor that runs auto-coder.rag (optional, default: LocalExecutor)
+	Executor Executor `json:"-"`
+
+	// Retry policy for failed queries (optional, default: no retries)
+	RetryPolicy *RetryPolicy `json:"-"`
+
+	// Circuit breaker that stops running queries after repeated failures
+	// (optional, default: disabled)
+	CircuitBreaker *CircuitBreakerConfig `json:"-"`
 }
 
 // NewRAGConfig creates a new RAG configuration with defaults
@@ -79,19 +109,52 @@ func NewRAGConfig(docDir string) *RAGConfig {
 		EnableHybridIndex:      false,
 		DisableAutoWindow:      false,
 		DisableSegmentReorder:  false,
-		RayAddress:             "auto",
+		RayAddress:             "",  // 为空时不传 --ray_address
 	}
 }
 
 // RAGQueryOptions represents options for a single query
 type RAGQueryOptions struct {
-	OutputFormat string // "text", "json", or "stream-json"
-	Agentic      *bool
-	ProductMode  string
-	Model        string
-	ModelFile    string            // Model configuration file path (overrides config)
-	Timeout      *int              // Timeout in seconds (overrides config)
-	Envs         map[string]string // Environment variables for this specific query (overrides global config)
+	OutputFormat     string // "text", "json", or "stream-json"
+	Agentic          *bool
+	ProductMode      string
+	Model            string
+	ModelFile        string            // Model configuration file path (overrides config)
+	Timeout          *int              // Timeout in seconds (overrides config)
+	FirstByteTimeout *int              // Streaming first line timeout in seconds (overrides config)
+	IdleTimeout      *int              // Streaming idle timeout in seconds (overrides config)
+	Envs             map[string]string // Environment variables for this specific query (overrides global config)
+
+	// Position in the wait queue when MaxConcurrency is reached
+	Priority     Priority
+	QueueTimeout *int // Queue wait timeout in seconds (overrides config)
+
+	// Retry policy for this query (overrides config)
+	RetryPolicy *RetryPolicy
+
+	// Optional model overrides (empty means use config)
+	RecallModel       string
+	ChunkModel        string
+	QAModel           string
+	EmbModel          string
+	AgenticModel      string
+	ContextPruneModel string
+
+	// Other overrides (empty means use config)
+	TokenizerPath string
+	RequiredExts  string
+	RayAddress    string
+
+	// RAG parameter overrides (nil means use config)
+	RagContextWindowLimit *int
+	FullTextRatio         *float64
+	SegmentRatio          *float64
+	RagDocFilterRelevance *float64
+
+	// Index configuration overrides (nil means use config)
+	EnableHybridIndex     *bool
+	DisableAutoWindow     *bool
+	DisableSegmentReorder *bool
 }
 
 // RAGResponse represents a RAG query response
@@ -100,6 +163,28 @@ type RAGResponse struct {
 	Answer   string
 	Contexts []string
 	Error    string
+
+	// Metadata reported by the end event
+	Metadata map[string]interface{}
+	// Token usage summed over every event that reports it
+	Tokens TokenInfo
+	// Processing stages in the order they started
+	Stages []StageInfo
+	// Total time spent on the query
+	Duration time.Duration
+	// Command line that was executed
+	Command []string
+	// Every attempt made, more than one when the query was retried
+	Attempts []AttemptInfo
+}
+
+// StageInfo describes one processing stage of a query
+type StageInfo struct {
+	Type      StageType
+	Status    string
+	Message   string
+	StartTime time.Time
+	Duration  time.Duration
 }
 
 // MessageType represents the type of message
@@ -289,40 +374,6 @@ func (m *Message) IsGenerationStage() bool {
 	return m.IsStage() && m.GetStageType() == StageTypeGeneration
 }
 
-// Custom error types
-var (
-	ErrValidation = errors.New("参数验证失败")
-	ErrExecution  = errors.New("执行失败")
-)
-
-// RAGError represents a general SDK error
-type RAGError struct {
-	Message string
-}
-
-func (e *RAGError) Error() string {
-	return e.Message
-}
-
-// ValidationError represents parameter validation errors
-type ValidationError struct {
-	Message string
-}
-
-func (e *ValidationError) Error() string {
-	return e.Message
-}
-
-// ExecutionError represents execution errors
-type ExecutionError struct {
-	Message  string
-	ExitCode int
-}
-
-func (e *ExecutionError) Error() string {
-	return e.Message
-}
-
 // AppendPath appends a path to the PATH environment variable in a cross-platform way
 func AppendPath(additionalPath string, currentPath string) string {
 	delimiter := ":"
@@ -370,15 +421,36 @@ type TokenCountResult struct {
 
 // TokenCountOptions represents options for token counting
 type TokenCountOptions struct {
+	// Command path (optional, default: "auto-coder.rag" or the client's CommandPath)
+	CommandPath string
 	// Path to the tokenizer file (optional, uses default if not provided)
 	TokenizerPath string
 	// Timeout in seconds (default: 60)
 	Timeout int
 	// Environment variables for the subprocess
 	Envs map[string]string
+	// Environment the subprocess starts from (optional, default: EnvModeInherit
+	// or the client's EnvMode)
+	EnvMode EnvMode
+	// Variables inherited in EnvModeAllowlist mode (optional, default: the
+	// client's EnvAllowlist)
+	EnvAllowlist []string
+	// Executor that runs the command (optional, default: LocalExecutor)
+	Executor Executor
+}
+
+// TokenCountDirOptions represents options for CountTokensDir
+type TokenCountDirOptions struct {
+	// Options applied to every file
+	TokenCountOptions
+	// Comma separated extensions to count, e.g. ".md,.txt" (default: all files)
+	RequiredExts string
+	// Maximum number of concurrent token count processes (default: 4)
+	Concurrency int
+	// Cache of results by content hash (optional)
+	Cache *TokenCountCache
 }
 
-
 // TextDocument represents a text document for NewRAGClientFromTexts
 //
 // Used to pass multiple documents when creating a RAG client.
@@ -393,7 +465,10 @@ type TextDocument struct {
 	// Document content (required)
 	Content string
 	// Filename (optional, auto-generated if empty)
+	// May contain "/" to place the document in a subdirectory.
+	// Absolute paths, ".." and reserved names are rejected.
 	Filename string
-	// File encoding (default: utf-8)
+	// Encoding of Content (default: utf-8), transcoded to UTF-8 on disk.
+	// Supported: utf-8, utf-16 (BOM detected), utf-16le, utf-16be, iso-8859-1
 	Encoding string
 }
@@ -0,0 +1,237 @@
+package ragclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// requiredExtPattern matches a single RequiredExts entry such as ".md",
+// "txt" or ".tar.gz"
+var requiredExtPattern = regexp.MustCompile(`^\.?[\p{L}\p{N}_+-]+(\.[\p{L}\p{N}_+-]+)*$`)
+
+// Validate checks the configuration and reports every problem at once
+//
+// The returned error is a *ConfigError matching ErrValidation. Besides the
+// checks done when a client is created, Validate also makes sure that
+// CommandPath resolves on PATH or as a file. When a custom Executor runs the
+// command elsewhere, DocDir, ModelFile, TokenizerPath and CommandPath are not
+// looked up locally.
+//
+// Example:
+//
+//	config, err := ragclient.LoadRAGConfig("rag.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := config.Validate(); err != nil {
+//	    var configErr *ragclient.ConfigError
+//	    if errors.As(err, &configErr) {
+//	        for _, problem := range configErr.Errors {
+//	            fmt.Println(problem.Message)
+//	        }
+//	    }
+//	}
+func (c *RAGConfig) Validate() error {
+	return c.validate(true)
+}
+
+// validate checks the configuration, resolving CommandPath only when
+// checkCommand is set
+func (c *RAGConfig) validate(checkCommand bool) error {
+	var errs []*ValidationError
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf(format, args...)})
+	}
+
+	// 自定义执行器在其他机器上运行命令时, 本地路径无需存在
+	local := !c.hasRemoteExecutor()
+
+	// 文档目录必须是可读的目录
+	if c.DocDir == "" {
+		add("DocDir 不能为空")
+	} else if local {
+		if info, err := os.Stat(c.DocDir); os.IsNotExist(err) {
+			add("文档目录不存在: %s", c.DocDir)
+		} else if err != nil {
+			add("无法访问文档目录: %v", err)
+		} else if !info.IsDir() {
+			add("DocDir 不是目录: %s", c.DocDir)
+		} else if err := checkReadableDir(c.DocDir); err != nil {
+			add("文档目录不可读: %v", err)
+		}
+	}
+
+	if c.ProductMode != "lite" && c.ProductMode != "pro" {
+		add("不支持的产品模式: %s", c.ProductMode)
+	}
+
+	if c.Timeout <= 0 {
+		add("Timeout 必须大于 0: %d", c.Timeout)
+	}
+	if c.FirstByteTimeout < 0 {
+		add("FirstByteTimeout 不能为负数: %d", c.FirstByteTimeout)
+	}
+	if c.IdleTimeout < 0 {
+		add("IdleTimeout 不能为负数: %d", c.IdleTimeout)
+	}
+	if c.MaxConcurrency < 0 {
+		add("MaxConcurrency 不能为负数: %d", c.MaxConcurrency)
+	}
+	if c.MaxQueueLength < 0 {
+		add("MaxQueueLength 不能为负数: %d", c.MaxQueueLength)
+	}
+	if c.QueueTimeout < 0 {
+		add("QueueTimeout 不能为负数: %d", c.QueueTimeout)
+	}
+
+	errs = append(errs, ragParamErrors(c.RagContextWindowLimit, c.FullTextRatio, c.SegmentRatio, c.RagDocFilterRelevance)...)
+	if err := ratioSumError(c.FullTextRatio, c.SegmentRatio); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.ModelFile != "" && local {
+		if err := checkRegularFile(c.ModelFile); err != nil {
+			add("ModelFile 无效: %v", err)
+		}
+	}
+	if c.TokenizerPath != "" && local {
+		if err := checkRegularFile(c.TokenizerPath); err != nil {
+			add("TokenizerPath 无效: %v", err)
+		}
+	}
+
+	if c.RequiredExts != "" {
+		for _, ext := range strings.Split(c.RequiredExts, ",") {
+			if !requiredExtPattern.MatchString(strings.TrimSpace(ext)) {
+				add("RequiredExts 格式错误: %q, 应为逗号分隔的后缀, 如 \".md,.txt\"", c.RequiredExts)
+				break
+			}
+		}
+	}
+
+	if !validEnvMode(c.EnvMode) {
+		add("不支持的环境变量模式: %s", c.EnvMode)
+	}
+
+	errs = append(errs, retryPolicyErrors(c.RetryPolicy)...)
+
+	if b := c.CircuitBreaker; b != nil {
+		if b.FailureThreshold < 0 {
+			add("CircuitBreaker.FailureThreshold 不能为负数: %d", b.FailureThreshold)
+		}
+		if b.OpenTimeout < 0 {
+			add("CircuitBreaker.OpenTimeout 不能为负数: %v", b.OpenTimeout)
+		}
+		if b.HalfOpenMaxProbes < 0 {
+			add("CircuitBreaker.HalfOpenMaxProbes 不能为负数: %d", b.HalfOpenMaxProbes)
+		}
+	}
+
+	if checkCommand && local {
+		if c.CommandPath == "" {
+			add("CommandPath 不能为空")
+		} else if _, err := exec.LookPath(c.CommandPath); err != nil {
+			add("命令不存在: %s (%v)", c.CommandPath, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ConfigError{Errors: errs}
+}
+
+// retryPolicyErrors checks the numeric fields of a retry policy, which may
+// be nil
+func retryPolicyErrors(p *RetryPolicy) []*ValidationError {
+	if p == nil {
+		return nil
+	}
+	var errs []*ValidationError
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf(format, args...)})
+	}
+	if p.MaxAttempts < 0 {
+		add("RetryPolicy.MaxAttempts 不能为负数: %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		add("RetryPolicy 的退避时间不能为负数: %v, %v", p.InitialBackoff, p.MaxBackoff)
+	}
+	if p.Multiplier < 0 {
+		add("RetryPolicy.Multiplier 不能为负数: %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		add("RetryPolicy.Jitter 必须在 0-1 之间: %v", p.Jitter)
+	}
+	return errs
+}
+
+// hasRemoteExecutor reports whether a custom executor runs the command, in
+// which case the command and the files it reads do not need to exist
+// locally
+func (c *RAGConfig) hasRemoteExecutor() bool {
+	if c.Executor == nil {
+		return false
+	}
+	_, local := c.Executor.(*LocalExecutor)
+	return !local
+}
+
+// checkReadableDir makes sure the directory entries can be listed
+func checkReadableDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// checkRegularFile makes sure path exists and is not a directory
+func checkRegularFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s 是目录", path)
+	}
+	return nil
+}
+
+// ratioSumError reports full-text and segment ratios that sum to more than 1
+func ratioSumError(fullTextRatio float64, segmentRatio float64) *ValidationError {
+	// 浮点误差内的和视为 1
+	if sum := fullTextRatio + segmentRatio; sum > 1+1e-9 {
+		return &ValidationError{Message: fmt.Sprintf("FullTextRatio + SegmentRatio 不能大于 1: %v", sum)}
+	}
+	return nil
+}
+
+// ragParamErrors checks the numeric RAG tuning parameters are in range
+func ragParamErrors(contextWindowLimit int, fullTextRatio float64, segmentRatio float64, docFilterRelevance float64) []*ValidationError {
+	var errs []*ValidationError
+	if contextWindowLimit <= 0 {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf("RagContextWindowLimit 必须大于 0: %d", contextWindowLimit)})
+	}
+	if math.IsNaN(fullTextRatio) || fullTextRatio < 0 || fullTextRatio > 1 {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf("FullTextRatio 必须在 [0, 1] 范围内: %v", fullTextRatio)})
+	}
+	if math.IsNaN(segmentRatio) || segmentRatio < 0 || segmentRatio > 1 {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf("SegmentRatio 必须在 [0, 1] 范围内: %v", segmentRatio)})
+	}
+	// auto-coder.rag 的文档相关性打分范围为 0-10
+	if math.IsNaN(docFilterRelevance) || docFilterRelevance < 0 || docFilterRelevance > 10 {
+		errs = append(errs, &ValidationError{Message: fmt.Sprintf("RagDocFilterRelevance 必须在 [0, 10] 范围内: %v", docFilterRelevance)})
+	}
+	return errs
+}
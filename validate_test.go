@@ -0,0 +1,185 @@
+package ragclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeCommand writes an executable file standing in for auto-coder.rag
+func fakeCommand(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("executable scripts are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "auto-coder.rag")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	command := fakeCommand(t)
+	missing := filepath.Join(t.TempDir(), "missing")
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		config   func(c *RAGConfig)
+		problems []string // substrings of the expected problems, in order
+	}{
+		{name: "valid"},
+		{name: "ratios sum to 1", config: func(c *RAGConfig) { c.FullTextRatio, c.SegmentRatio = 0.7, 0.3 }},
+		{
+			name:     "ratios sum to more than 1",
+			config:   func(c *RAGConfig) { c.FullTextRatio, c.SegmentRatio = 0.7, 0.4 },
+			problems: []string{"FullTextRatio + SegmentRatio"},
+		},
+		{name: "missing doc dir", config: func(c *RAGConfig) { c.DocDir = missing }, problems: []string{"文档目录不存在"}},
+		{name: "doc dir is a file", config: func(c *RAGConfig) { c.DocDir = file }, problems: []string{"DocDir 不是目录"}},
+		{name: "missing command", config: func(c *RAGConfig) { c.CommandPath = missing }, problems: []string{"命令不存在"}},
+		{name: "invalid required exts", config: func(c *RAGConfig) { c.RequiredExts = "md;txt" }, problems: []string{"RequiredExts"}},
+		{
+			name: "several problems",
+			config: func(c *RAGConfig) {
+				c.ProductMode = "max"
+				c.Timeout = 0
+				c.FullTextRatio = 1.5
+				c.ModelFile = missing
+				c.RetryPolicy = &RetryPolicy{Jitter: 2}
+				c.CircuitBreaker = &CircuitBreakerConfig{FailureThreshold: -1}
+			},
+			problems: []string{
+				"不支持的产品模式", "Timeout 必须大于 0", "FullTextRatio 必须在", "FullTextRatio + SegmentRatio",
+				"ModelFile 无效", "RetryPolicy.Jitter", "CircuitBreaker.FailureThreshold",
+			},
+		},
+		{
+			name: "remote executor",
+			config: func(c *RAGConfig) {
+				c.Executor = &scriptedExecutor{}
+				c.DocDir = "/srv/docs"
+				c.ModelFile = missing
+				c.TokenizerPath = missing
+				c.CommandPath = "auto-coder.rag-on-another-host"
+			},
+		},
+		{
+			name: "local executor",
+			config: func(c *RAGConfig) {
+				c.Executor = &LocalExecutor{}
+				c.DocDir = missing
+				c.ModelFile = missing
+				c.TokenizerPath = missing
+				c.CommandPath = missing
+			},
+			problems: []string{"文档目录不存在", "ModelFile 无效", "TokenizerPath 无效", "命令不存在"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewRAGConfig(t.TempDir())
+			config.CommandPath = command
+			if tt.config != nil {
+				tt.config(config)
+			}
+
+			err := config.Validate()
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Validate() error = %v, want a ConfigError", err)
+			}
+			if len(configErr.Errors) != len(tt.problems) {
+				t.Fatalf("Validate() reported %d problems, want %d:\n%v", len(configErr.Errors), len(tt.problems), err)
+			}
+			for i, problem := range tt.problems {
+				if !strings.Contains(configErr.Errors[i].Message, problem) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, configErr.Errors[i].Message, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	first := &ValidationError{Message: "Timeout 必须大于 0: 0"}
+	second := &ValidationError{Message: "不支持的产品模式: max"}
+	err := error(&ConfigError{Errors: []*ValidationError{first, second}})
+
+	if !errors.Is(err, ErrValidation) {
+		t.Error("ConfigError does not match ErrValidation")
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr != first {
+		t.Errorf("errors.As() = %v, want the first problem", validationErr)
+	}
+	unwrapped := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(unwrapped) != 2 || unwrapped[0] != error(first) || unwrapped[1] != error(second) {
+		t.Errorf("Unwrap() = %v, want both problems", unwrapped)
+	}
+	if want := "配置无效, 共 2 个问题:\n- " + first.Message + "\n- " + second.Message; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if single := (&ConfigError{Errors: []*ValidationError{first}}).Error(); single != first.Message {
+		t.Errorf("Error() of a single problem = %q, want %q", single, first.Message)
+	}
+}
+
+func TestNewRAGClientConfigError(t *testing.T) {
+	config := NewRAGConfig(filepath.Join(t.TempDir(), "missing"))
+	config.Timeout = 0
+
+	_, err := NewRAGClientWithConfig(config)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Errors) != 2 {
+		t.Fatalf("NewRAGClientWithConfig() error = %v, want a ConfigError with 2 problems", err)
+	}
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("NewRAGClientWithConfig() error = %v, want it to match ErrValidation", err)
+	}
+}
+
+func TestValidateQueryOptionsRatioSum(t *testing.T) {
+	tests := []struct {
+		name     string
+		fullText *float64
+		segment  *float64
+		wantErr  bool
+	}{
+		{name: "config values"},
+		{name: "full text override within budget", fullText: floatPtr(0.8)},
+		{name: "full text override exceeds 1 with config segment", fullText: floatPtr(0.9), wantErr: true},
+		{name: "segment override exceeds 1 with config full text", segment: floatPtr(0.5), wantErr: true},
+		{name: "both overridden", fullText: floatPtr(0.9), segment: floatPtr(0.1)},
+	}
+
+	config := NewRAGConfig(t.TempDir())
+	config.FullTextRatio = 0.7
+	config.SegmentRatio = 0.2
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &RAGQueryOptions{FullTextRatio: tt.fullText, SegmentRatio: tt.segment}
+			err := validateQueryOptions(config, options)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("validateQueryOptions() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrValidation) {
+				t.Errorf("validateQueryOptions() error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}